@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxFieldLength bounds the values coming from the client
+const maxFieldLength = 256
+
+// Record appends an entry to the audit log with the IP, user agent and time of the
+// request. The actor defaults to the authenticated user or API key. Errors are
+// logged, a failing audit write does not fail the request.
+func Record(c *gin.Context, entry models.AuditEntry) {
+	if entry.Actor == "" {
+		entry.Actor = currentActor(c)
+	}
+	entry.Actor = truncate(entry.Actor)
+	entry.Reason = truncate(entry.Reason)
+	entry.IP = c.ClientIP()
+	entry.UserAgent = truncate(c.Request.UserAgent())
+	if entry.Outcome == "" {
+		entry.Outcome = models.AuditSuccess
+	}
+	if len(entry.Details) == 0 {
+		entry.Details = nil
+	}
+
+	// MongoDB keeps milliseconds, the hash must be computed on the stored value
+	entry.Timestamp = time.Now().UTC().Truncate(time.Millisecond)
+
+	// Entries are chained by a single writer, the request does not wait for the database
+	if writer := currentWriter(); writer != nil {
+		writer.Push(entry)
+		return
+	}
+	appendEntry(entry)
+}
+
+// Failure records a failed action with its reason
+func Failure(c *gin.Context, action, actor, reason string) {
+	Record(c, models.AuditEntry{Action: action, Outcome: models.AuditFailure, Actor: actor, Reason: reason})
+}
+
+func currentActor(c *gin.Context) string {
+	value, exists := c.Get("user")
+	if !exists {
+		return ""
+	}
+	claims, ok := value.(*utils.JWTClaims)
+	if !ok {
+		return ""
+	}
+	if claims.Username != "" {
+		return claims.Username
+	}
+	return claims.Subject
+}
+
+func truncate(value string) string {
+	if len(value) > maxFieldLength {
+		return value[:maxFieldLength]
+	}
+	return value
+}
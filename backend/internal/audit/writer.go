@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"backend/internal/models"
+	"backend/internal/queue"
+	"backend/mongodb"
+)
+
+// QueueSize bounds the entries waiting for the writer
+const QueueSize = 1024
+
+// maxAppendAttempts bounds the retries when another instance appended the same seq
+const maxAppendAttempts = 5
+
+var (
+	writerMu sync.Mutex
+	writer   *queue.Queue[models.AuditEntry]
+
+	// chainKey keys the hashes of the entries, set by Configure
+	chainKey []byte
+)
+
+// head is the last entry appended by this instance, the next entry is chained to it
+// without reading the log. It is reloaded when another instance appended meanwhile.
+var head = struct {
+	sync.Mutex
+	loaded bool
+	seq    int64
+	hash   string
+}{}
+
+// Configure sets AUDIT_SECRET, the key of the hash chain
+func Configure(secret string) {
+	chainKey = []byte(secret)
+}
+
+// Start starts the writer appending the recorded entries in order, it returns a function
+// stopping it once the queued entries are written. Entries recorded while no writer
+// runs are appended by the request itself.
+func Start() (stop func()) {
+	writerMu.Lock()
+	defer writerMu.Unlock()
+
+	q := queue.Start("audit", QueueSize, appendEntry)
+	writer = q
+
+	return func() {
+		q.Stop()
+		writerMu.Lock()
+		if writer == q {
+			writer = nil
+		}
+		writerMu.Unlock()
+	}
+}
+
+// CheckQueue is the readiness check of the writer, it fails when the queue is saturated
+func CheckQueue(ctx context.Context) error {
+	if q := currentWriter(); q != nil {
+		return q.Check(ctx)
+	}
+	return nil
+}
+
+// Verify checks the hash chain of the whole log
+func Verify() (mongodb.AuditChainReport, error) {
+	return mongodb.VerifyAuditChain(chainKey)
+}
+
+func currentWriter() *queue.Queue[models.AuditEntry] {
+	writerMu.Lock()
+	defer writerMu.Unlock()
+	return writer
+}
+
+// appendEntry chains the entry to the head and inserts it. Errors are logged,
+// the entry is lost if the database keeps failing.
+func appendEntry(entry models.AuditEntry) {
+	head.Lock()
+	defer head.Unlock()
+
+	entry.HashVersion = models.AuditHashKeyed
+	for attempt := 0; attempt < maxAppendAttempts; attempt++ {
+		if !head.loaded {
+			last, err := mongodb.LastAuditEntry()
+			if err != nil {
+				fmt.Println("Error writing audit entry", entry.Action, err)
+				return
+			}
+			head.seq, head.hash = 0, ""
+			if last != nil {
+				head.seq, head.hash = last.Seq, last.Hash
+			}
+			head.loaded = true
+		}
+
+		entry.Seq = head.seq + 1
+		entry.PrevHash = head.hash
+		entry.Hash = entry.ComputeHash(chainKey)
+
+		err := mongodb.InsertAuditEntry(entry)
+		if err == nil {
+			head.seq, head.hash = entry.Seq, entry.Hash
+			return
+		}
+		head.loaded = false
+		if !errors.Is(err, mongodb.ErrAuditSeqTaken) {
+			fmt.Println("Error writing audit entry", entry.Action, err)
+			return
+		}
+	}
+
+	fmt.Println("Error writing audit entry", entry.Action, "too many concurrent appends")
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// API keys are sent in the X-API-Key header or as "Authorization: ApiKey <key>"
+const (
+	APIKeyHeader     = "X-API-Key"
+	APIKeyScheme     = "ApiKey "
+	apiKeyPrefix     = "rdj_"
+	DefaultAPIKeyTTL = 90 * 24 * time.Hour
+	MaxAPIKeyTTL     = 365 * 24 * time.Hour
+)
+
+// apiKeyTouchInterval limits the writes of the last used timestamp
+const apiKeyTouchInterval = time.Minute
+
+// CreateAPIKey creates an API key with read-only scopes. The key is returned
+// only in this response, the database keeps its hash.
+func CreateAPIKey(c *gin.Context) {
+	var request models.APIKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	name := stripSpaces(request.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "name is required", "fieldError": "name"})
+		return
+	}
+
+	if len(request.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "at least one scope is required", "fieldError": "scopes"})
+		return
+	}
+	claims := CurrentClaims(c)
+	for _, scope := range request.Scopes {
+		if !models.IsValidAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid scope " + scope, "fieldError": "scopes"})
+			return
+		}
+		// A key cannot grant more than its creator has
+		if claims == nil || !claims.HasPermission(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Missing permission " + scope, "fieldError": "scopes"})
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(DefaultAPIKeyTTL)
+	if request.ExpiresAt != nil {
+		expiresAt = request.ExpiresAt.UTC()
+	}
+	if !expiresAt.After(now) || expiresAt.Sub(now) > MaxAPIKeyTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "expiration must be in the next 365 days", "fieldError": "expiresAt"})
+		return
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create API key"})
+		return
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := models.APIKey{
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		KeyHash:   utils.HashToken(key),
+		Scopes:    request.Scopes,
+		CreatedBy: CurrentUsername(c),
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+
+	id, err := mongodb.SaveAPIKey(apiKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create API key"})
+		return
+	}
+	apiKey.ID = id
+
+	audit.Record(c, models.AuditEntry{
+		Action:  models.AuditAPIKeyCreate,
+		Target:  id,
+		Details: map[string]string{"name": name, "scopes": strings.Join(request.Scopes, ",")},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"apiKey": apiKey, "key": key})
+}
+
+// ListAPIKeys returns the API keys, revoked and expired ones included
+func ListAPIKeys(c *gin.Context) {
+	keys, err := mongodb.ListAPIKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not list API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apiKeys": keys})
+}
+
+// RevokeAPIKey revokes an API key, requests using it are refused immediately
+func RevokeAPIKey(c *gin.Context) {
+	if err := mongodb.RevokeAPIKey(c.Param("id")); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"message": "API key not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid API key id"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditAPIKeyRevoke, Target: c.Param("id")})
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// apiKeyFromRequest returns the API key sent with the request, empty if none
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return strings.TrimSpace(key)
+	}
+	if authorization := c.GetHeader("Authorization"); strings.HasPrefix(authorization, APIKeyScheme) {
+		return strings.TrimSpace(authorization[len(APIKeyScheme):])
+	}
+	return ""
+}
+
+// authenticateAPIKey checks the key and sets claims carrying only its scopes.
+// The claims have no username, so routes acting on the current user refuse API keys.
+func authenticateAPIKey(c *gin.Context, key string) {
+	apiKey, err := mongodb.FindAPIKey(utils.HashToken(key))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not check API key"})
+		c.Abort()
+		return
+	}
+
+	now := time.Now().UTC()
+	if apiKey == nil || apiKey.RevokedAt != nil || !now.Before(apiKey.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	// Keys stop working with their creator, when it is disabled or deleted
+	creator, err := loadPrincipal(apiKey.CreatedBy)
+	if err != nil || creator.Disabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid API key"})
+		c.Abort()
+		return
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		if err := mongodb.TouchAPIKey(apiKey.ID, now); err != nil {
+			fmt.Println("Error updating API key last use", err)
+		}
+	}
+
+	claims := &utils.JWTClaims{Permissions: apiKey.Scopes}
+	claims.Subject = "apikey:" + apiKey.ID
+
+	c.Set("user", claims)
+	c.Set("apiKey", apiKey)
+	c.Next()
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Names of the session cookies and of the CSRF header
+const (
+	SessionCookie = "rdj_session"
+	RefreshCookie = "rdj_refresh"
+	CSRFCookie    = "rdj_csrf"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// refreshCookiePath limits the refresh cookie to the routes using it
+const refreshCookiePath = "/auth"
+
+// AUTH_MODE selects how tokens reach the client: "header" (default) returns them in
+// the body for the Authorization header, "cookie" keeps them in HttpOnly cookies
+// that scripts cannot read, with a double-submit CSRF token for mutating requests.
+func cookieMode() bool {
+	return settings.Auth.CookieMode
+}
+
+// setSessionCookies moves the tokens of the response into cookies and adds the CSRF token
+func setSessionCookies(c *gin.Context, response gin.H) error {
+	csrfToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	token, _ := response["token"].(string)
+	refreshToken, _ := response["refreshToken"].(string)
+
+	setCookie(c, SessionCookie, token, "/", int(utils.AccessTokenTTL.Seconds()), true)
+	setCookie(c, RefreshCookie, refreshToken, refreshCookiePath, int(RefreshTokenTTL.Seconds()), true)
+	// Readable by the frontend, which sends it back in the CSRF header
+	setCookie(c, CSRFCookie, csrfToken, "/", int(RefreshTokenTTL.Seconds()), false)
+
+	delete(response, "token")
+	delete(response, "refreshToken")
+	response["csrfToken"] = csrfToken
+	return nil
+}
+
+// clearSessionCookies removes the session cookies, on logout
+func clearSessionCookies(c *gin.Context) {
+	setCookie(c, SessionCookie, "", "/", -1, true)
+	setCookie(c, RefreshCookie, "", refreshCookiePath, -1, true)
+	setCookie(c, CSRFCookie, "", "/", -1, false)
+}
+
+func setCookie(c *gin.Context, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   settings.Auth.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   cookieSecure(),
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite(),
+	})
+}
+
+// cookieSecure is COOKIE_SECURE, cookies are only sent over HTTPS unless it is false
+func cookieSecure() bool {
+	return settings.Auth.CookieSecure
+}
+
+// cookieSameSite is COOKIE_SAMESITE: strict (default), lax or none
+func cookieSameSite() http.SameSite {
+	switch settings.Auth.CookieSameSite {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+// isSafeMethod reports whether the request cannot change state, so it needs no CSRF token
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// validCSRF checks the double-submit token: the header must match the CSRF cookie
+func validCSRF(c *gin.Context) bool {
+	cookie, err := c.Cookie(CSRFCookie)
+	header := c.GetHeader(CSRFHeader)
+	if err != nil || cookie == "" || header == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
+
+// sessionCookie returns the value of a session cookie when cookie mode is enabled
+func sessionCookie(c *gin.Context, name string) string {
+	if !cookieMode() {
+		return ""
+	}
+	value, err := c.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return value
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/models"
+	"backend/internal/passwords"
+	"backend/internal/utils"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// InvitationTTL is how long an invitation can be accepted
+const InvitationTTL = 72 * time.Hour
+
+// CreateInvitation creates a single use invitation for an email and a role.
+// The token is returned only in this response, the database keeps its hash.
+func CreateInvitation(c *gin.Context) {
+	var request models.InvitationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	email := stripSpaces(request.Email)
+	if !validateEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid email format", "fieldError": "email"})
+		return
+	}
+	email = strings.ToLower(email)
+
+	role := stripSpaces(request.Role)
+	if role == "" {
+		role = models.RoleViewer
+	}
+	if !models.IsValidRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid role", "fieldError": "role"})
+		return
+	}
+	if !canGrant(c, role, nil) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only an owner can grant user management"})
+		return
+	}
+
+	if existing, err := mongodb.FindUserByEmailRegistration(email); err == nil && existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "this email is already registered", "fieldError": "email"})
+		return
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create invitation"})
+		return
+	}
+
+	now := time.Now().UTC()
+	invitation := models.Invitation{
+		TokenHash: utils.HashToken(token),
+		Email:     email,
+		Role:      role,
+		InvitedBy: CurrentUsername(c),
+		CreatedAt: now,
+		ExpiresAt: now.Add(InvitationTTL),
+	}
+
+	id, err := mongodb.SaveInvitation(invitation)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create invitation"})
+		return
+	}
+	invitation.ID = id
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditInvitationCreate, Target: email, Details: map[string]string{"role": role, "invitation": id}})
+
+	c.JSON(http.StatusCreated, gin.H{"invitation": invitation, "token": token})
+}
+
+// ListInvitations returns the invitations, accepted and expired ones included
+func ListInvitations(c *gin.Context) {
+	invitations, err := mongodb.ListInvitations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not list invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// RevokeInvitation deletes an invitation so it can no longer be accepted
+func RevokeInvitation(c *gin.Context) {
+	if err := mongodb.DeleteInvitation(c.Param("id")); err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Invitation not found"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid invitation id"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditInvitationRevoke, Target: c.Param("id")})
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked"})
+}
+
+// AcceptInvitation creates the invited user with the chosen username and password
+// and logs it in. The invitation is consumed before the user is created.
+func AcceptInvitation(c *gin.Context) {
+	var request models.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	tokenHash := utils.HashToken(stripSpaces(request.Token))
+	invitation, err := mongodb.FindInvitation(tokenHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not accept invitation"})
+		return
+	}
+	if invitation == nil || invitation.UsedAt != nil || time.Now().After(invitation.ExpiresAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired invitation", "fieldError": "token"})
+		return
+	}
+
+	user := models.User{
+		Email:    invitation.Email,
+		Username: request.Username,
+		Password: request.Password,
+	}
+	stripUserFields(&user)
+
+	if valid, fieldError, err := checkValidUser(&user); !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error(), "fieldError": fieldError})
+		return
+	}
+	if fieldError, err := checkIfUserExists(user.Email, user.Username); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error(), "fieldError": fieldError})
+		return
+	}
+
+	hashedPassword, err := passwords.Hash(user.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not hash password"})
+		return
+	}
+
+	// Consume the invitation first, two concurrent requests cannot both create a user
+	marked, err := mongodb.MarkInvitationUsed(tokenHash, user.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not accept invitation"})
+		return
+	}
+	if !marked {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired invitation", "fieldError": "token"})
+		return
+	}
+
+	now := time.Now().UTC()
+	user.Password = hashedPassword
+	user.Role = invitation.Role
+	user.CreatedAt = &now
+
+	userId, err := mongodb.CreateUser(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create user"})
+		return
+	}
+
+	response, err := issueTokens(c, &user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create token"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{
+		Action:  models.AuditInvitationAccept,
+		Actor:   user.Username,
+		Target:  invitation.Email,
+		Details: map[string]string{"role": invitation.Role, "invitedBy": invitation.InvitedBy},
+	})
+
+	response["id"] = userId
+	response["user"] = user.Username
+	c.JSON(http.StatusCreated, response)
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keyCheckInterval is how often the key ring is reloaded and rotated if needed
+const keyCheckInterval = 10 * time.Minute
+
+// jwksMaxAge is how long clients may cache the JWKS
+const jwksMaxAge = 5 * time.Minute
+
+// KeyPublishAhead is how long before signing a new key is published in the JWKS, so clients
+// caching it for jwksMaxAge know the key of every token. It is at most half JWT_KEY_ROTATION.
+const KeyPublishAhead = time.Hour
+
+// InitSigningKeys loads the signing keys from the database, creating the first one
+// if needed. The server cannot issue tokens without them, so errors are fatal.
+// JWT_SECRET was checked by the configuration, Configure must run first.
+func InitSigningKeys() {
+	utils.ReloadSigningKeys = reloadSigningKeys
+
+	if err := rotateSigningKeys(time.Now()); err != nil {
+		log.Fatal("Could not load signing keys: ", err)
+	}
+}
+
+// StartKeyRotation checks the key ring periodically, it returns a function stopping the checks.
+// The function returns once a rotation in progress is written, before the database is closed.
+func StartKeyRotation() (stop func()) {
+	ticker := time.NewTicker(keyCheckInterval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				if err := rotateSigningKeys(time.Now()); err != nil {
+					fmt.Println("Error rotating signing keys", err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// JWKS publishes the public keys verifying the access tokens
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(jwksMaxAge.Seconds())))
+	c.JSON(http.StatusOK, utils.PublicJWKS(time.Now()))
+}
+
+// rotateSigningKeys reloads the keys and publishes the next key KeyPublishAhead before
+// the current one stops signing. Without any key signing, on the first start, the new key
+// signs at once.
+func rotateSigningKeys(now time.Time) error {
+	keys, err := loadSigningKeys(now)
+	if err != nil {
+		return err
+	}
+
+	rotation, grace := keyLifetimes()
+	publishAhead := min(KeyPublishAhead, rotation/2)
+
+	// The keys cover the signing until the latest RotateAt
+	signFrom := now
+	for _, key := range keys {
+		if key.RotateAt.After(signFrom) {
+			signFrom = key.RotateAt
+		}
+	}
+	if signFrom.Sub(now) > publishAhead {
+		utils.SetSigningKeys(keys)
+		return nil
+	}
+
+	key, err := utils.GenerateSigningKey(now, signFrom, rotation, grace)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := utils.EncryptPrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+
+	err = mongodb.SaveSigningKey(models.SigningKey{
+		ID:         key.ID,
+		Algorithm:  utils.SigningAlgorithm,
+		PublicKey:  base64.StdEncoding.EncodeToString(key.Public),
+		PrivateKey: encrypted,
+		CreatedAt:  key.CreatedAt,
+		SignFrom:   key.SignFrom,
+		RotateAt:   key.RotateAt,
+		ExpiresAt:  key.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Created signing key", key.ID, "signing from", key.SignFrom.Format(time.RFC3339), "rotating at", key.RotateAt.Format(time.RFC3339))
+	utils.SetSigningKeys(append([]utils.SigningKey{*key}, keys...))
+	return nil
+}
+
+func reloadSigningKeys() error {
+	keys, err := loadSigningKeys(time.Now())
+	if err != nil {
+		return err
+	}
+	utils.SetSigningKeys(keys)
+	return nil
+}
+
+// loadSigningKeys reads and decrypts the stored keys. Keys that cannot be
+// decrypted, after a change of JWT_SECRET, are skipped.
+func loadSigningKeys(now time.Time) ([]utils.SigningKey, error) {
+	stored, err := mongodb.ListSigningKeys(now)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []utils.SigningKey{}
+	for _, s := range stored {
+		if s.Algorithm != utils.SigningAlgorithm {
+			continue
+		}
+
+		private, err := utils.DecryptPrivateKey(s.PrivateKey)
+		if err != nil {
+			fmt.Println("Skipping signing key", s.ID, err)
+			continue
+		}
+
+		keys = append(keys, utils.SigningKey{
+			ID:        s.ID,
+			Private:   private,
+			Public:    private.Public().(ed25519.PublicKey),
+			CreatedAt: s.CreatedAt,
+			SignFrom:  s.SignFrom,
+			RotateAt:  s.RotateAt,
+			ExpiresAt: s.ExpiresAt,
+		})
+	}
+	return keys, nil
+}
+
+// keyLifetimes returns JWT_KEY_ROTATION and JWT_KEY_GRACE. The grace period is at
+// least the access token lifetime, tokens must not outlive their key.
+func keyLifetimes() (time.Duration, time.Duration) {
+	rotation := settings.Auth.KeyRotation
+	if rotation <= 0 {
+		rotation = config.DefaultKeyRotation
+	}
+
+	grace := settings.Auth.KeyGrace
+	if grace < utils.AccessTokenTTL {
+		grace = utils.AccessTokenTTL
+	}
+
+	return rotation, grace
+}
@@ -4,30 +4,32 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"backend/internal/utils"
+	"backend/mongodb"
 
 	"github.com/gin-gonic/gin"
 )
 
-// JWTMiddleware checks the token for authentication
+// JWTMiddleware checks the token for authentication. It is attached by the authenticated
+// and permissioned route groups of Router, public routes never run it.
 func JWTMiddleware(c *gin.Context) {
-	if c.Request.Method == http.MethodOptions {
-		c.Next()
+	// Scripts authenticate with an API key instead of a token
+	if key := apiKeyFromRequest(c); key != "" {
+		authenticateAPIKey(c, key)
 		return
 	}
 
-	// Skip the routes that don't require authentication
-	// login is public
-	// download pdf is public
-	// info is public (for tracking)
-	if c.Request.URL.Path == "/login" || c.Request.URL.Path == "/cv/download" || c.Request.URL.Path == "/info" {
-		c.Next()
-		return
-	}
-
-	// Extract the token from the Authorization header
+	// Extract the token from the Authorization header, or from the session cookie
 	tokenString := c.GetHeader("Authorization")
+	fromCookie := false
+	if tokenString == "" {
+		if cookie := sessionCookie(c, SessionCookie); cookie != "" {
+			tokenString = "Bearer " + cookie
+			fromCookie = true
+		}
+	}
 	if tokenString == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"message": "Missing token"})
 		c.Abort()
@@ -41,6 +43,13 @@ func JWTMiddleware(c *gin.Context) {
 		return
 	}
 
+	// Browsers send cookies on their own, mutating requests must prove they come from the frontend
+	if fromCookie && !isSafeMethod(c.Request.Method) && !validCSRF(c) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Invalid CSRF token"})
+		c.Abort()
+		return
+	}
+
 	// Remove "Bearer " prefix and validate the token
 	tokenString = tokenString[7:]
 
@@ -52,13 +61,58 @@ func JWTMiddleware(c *gin.Context) {
 		return
 	}
 
-	user, err := GetUserFromToken(tokenString)
-	if user == nil || err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": fmt.Sprintf("Invalid token: %v", err)})
+	// Tokens without id cannot be revoked, they were issued before logout existed
+	if claims.ID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token: missing token id"})
+		c.Abort()
+		return
+	}
+
+	revoked, err := mongodb.IsAccessTokenRevoked(claims.ID)
+	if err != nil || revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token: token revoked"})
+		c.Abort()
+		return
+	}
+
+	// Tokens of terminated sessions are refused
+	if claims.SessionID != "" {
+		session, err := mongodb.FindSession(claims.SessionID)
+		if err != nil || session == nil || session.RevokedAt != nil || session.Username != claims.Username {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token: session terminated"})
+			c.Abort()
+			return
+		}
+		touchSession(c, session)
+	}
+
+	// The user is cached for a short time, role and status changes invalidate it
+	user, err := loadPrincipal(claims.Username)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": fmt.Sprintf("Invalid token: could not find user: %v", err)})
 		c.Abort()
 		return
 	}
 
+	if user.Disabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Account disabled"})
+		c.Abort()
+		return
+	}
+
+	// Sessions are closed by a password reset, iat has a precision of one second
+	if user.SessionsRevokedAt != nil && claims.IssuedAt != nil &&
+		claims.IssuedAt.Time.Before(user.SessionsRevokedAt.Truncate(time.Second)) {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token: session closed"})
+		c.Abort()
+		return
+	}
+
+	// Role changes apply immediately, without waiting for the token to expire
+	claims.Role = user.Role
+	claims.Permissions = user.EffectivePermissions()
+
 	c.Set("user", claims)
+	setCurrentUser(c, user)
 	c.Next()
 }
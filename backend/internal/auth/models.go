@@ -1,7 +1,9 @@
 package auth
 
 import (
+	"backend/internal/audit"
 	"backend/internal/models"
+	"backend/internal/passwords"
 	"backend/internal/utils"
 
 	"backend/mongodb"
@@ -9,10 +11,10 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Register handles user registration by creating a new user
@@ -28,6 +30,10 @@ func Register(c *gin.Context) {
 	// Strip extra spaces from user fields
 	stripUserFields(&user)
 
+	// Self registered users can only read, roles are changed by an owner
+	user.Role = models.RoleViewer
+	user.Permissions = nil
+
 	// Validate the user's data
 	if valid, fieldError, err := checkValidUser(&user); !valid {
 		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error(), "fieldError": fieldError})
@@ -41,12 +47,16 @@ func Register(c *gin.Context) {
 	}
 
 	// Hash the password before saving (ensure strong hash)
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := passwords.Hash(user.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not hash password : " + err.Error()})
 		return
 	}
-	user.Password = string(hashedPassword)
+	now := time.Now().UTC()
+	user.Password = hashedPassword
+	user.CreatedAt = &now
+	user.Disabled = false
+	user.TOTPEnabled = false
 	userId, err := mongodb.CreateUser(user)
 
 	// Create the user in the database
@@ -55,15 +65,17 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// Generate JWT token for the newly created user
-	token, expiration, err := utils.GenerateJWT(user.Username)
+	// Generate access and refresh tokens for the newly created user
+	response, err := issueTokens(c, &user, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create token : " + err.Error()})
 		return
 	}
 
-	// Return the JWT token to the user
-	c.JSON(http.StatusOK, gin.H{"token": token, "expiration": expiration, "id": userId, "user": user.Username})
+	// Return the tokens to the user
+	response["id"] = userId
+	response["user"] = user.Username
+	c.JSON(http.StatusOK, response)
 }
 
 func checkIfUserExists(email, username string) (string, error) {
@@ -98,14 +110,15 @@ func checkValidUser(user *models.User) (bool, string, error) {
 	if !validateEmail(user.Email) {
 		return false, "email", fmt.Errorf("invalid email format")
 	}
-	if !validatePassword(user.Password) {
-		return false, "password", fmt.Errorf("password must be 8+ characters with uppercase, lowercase, number, and special character")
+	if err := validatePassword(user.Password); err != nil {
+		return false, "password", err
 	}
 
 	return true, "", nil
 }
 
-func validatePassword(password string) bool {
+// validatePassword checks the complexity of the password and refuses common and breached passwords
+func validatePassword(password string) error {
 	var (
 		hasMinLen  = false
 		hasUpper   = false
@@ -134,7 +147,14 @@ func validatePassword(password string) bool {
 	}
 
 	// Check all conditions
-	return hasMinLen && hasUpper && hasLower && hasNumber && hasSpecial
+	if !hasMinLen || !hasUpper || !hasLower || !hasNumber || !hasSpecial {
+		return fmt.Errorf("password must be 8+ characters with uppercase, lowercase, number, and special character")
+	}
+
+	if passwords.IsCommon(password) {
+		return fmt.Errorf("this password is too common, please choose another one")
+	}
+	return nil
 }
 
 func validateEmail(email string) bool {
@@ -181,6 +201,15 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Throttled attempts get the same answer as wrong credentials, without checking them
+	now := time.Now()
+	throttleKeys := loginThrottleKeys(identifier, c.ClientIP())
+	if wait := loginRetryAfter(throttleKeys, now); wait > 0 {
+		audit.Failure(c, models.AuditLogin, identifier, "throttled")
+		rejectLogin(c, wait)
+		return
+	}
+
 	var storedUser *models.User
 	var err error
 
@@ -192,23 +221,91 @@ func Login(c *gin.Context) {
 	}
 
 	if err != nil || storedUser == nil {
-		c.JSON(http.StatusForbidden, gin.H{"message": "Invalid credentials", "fieldError": "unauthorized"})
+		compareDummyPassword(password)
+		recordLoginFailure(throttleKeys, now)
+		audit.Failure(c, models.AuditLogin, identifier, "unknown_user")
+		rejectLogin(c, 0)
 		return
 	}
 
 	// Verifica password
-	if err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(password)); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"message": "Invalid credentials", "fieldError": "unauthorized"})
+	match, needsRehash := passwords.Verify(password, storedUser.Password)
+	if !match {
+		recordLoginFailure(throttleKeys, now)
+		audit.Failure(c, models.AuditLogin, storedUser.Username, "wrong_password")
+		rejectLogin(c, 0)
+		return
+	}
+	clearLoginFailures(throttleKeys)
+
+	if storedUser.Disabled {
+		audit.Failure(c, models.AuditLogin, storedUser.Username, "disabled")
+		c.JSON(http.StatusForbidden, gin.H{"message": "Account disabled", "fieldError": "unauthorized"})
+		return
+	}
+
+	// Legacy bcrypt hashes and outdated parameters are upgraded while the password is known.
+	// The password is verified here, accounts waiting for their second factor are upgraded
+	// too, VerifyMFA no longer has the password. Refused accounts are never written to.
+	if needsRehash && !storedUser.PasskeyOnly {
+		rehashPassword(storedUser, password)
+	}
+
+	if secondFactorPending(c, storedUser, models.AuditLogin) {
 		return
 	}
 
 	// Genera Token
-	token, expiration, err := utils.GenerateJWT(storedUser.Username)
+	response, err := issueTokens(c, storedUser, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create token"})
 		return
 	}
 
-	// Send the token back to the user in the response
-	c.JSON(http.StatusOK, gin.H{"token": token, "expiration": expiration, "id": storedUser.ID, "user": storedUser.Username})
+	audit.Record(c, models.AuditEntry{Action: models.AuditLogin, Actor: storedUser.Username})
+
+	// Send the tokens back to the user in the response
+	response["id"] = storedUser.ID
+	response["user"] = storedUser.Username
+	c.JSON(http.StatusOK, response)
+}
+
+// secondFactorPending stops the logins which need more than the first factor, a password
+// or an identity provider login: passkey-only accounts are refused, and users with
+// two-factor authentication get a token for /auth/mfa/verify. It returns true when the
+// response is written.
+func secondFactorPending(c *gin.Context, user *models.User, action string) bool {
+	if user.PasskeyOnly {
+		audit.Failure(c, action, user.Username, "passkey_only")
+		c.JSON(http.StatusForbidden, gin.H{"message": "This account signs in with a passkey", "fieldError": "unauthorized"})
+		return true
+	}
+
+	if user.TOTPEnabled {
+		mfaToken, mfaExpiration, err := utils.GenerateMFAToken(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create token"})
+			return true
+		}
+		audit.Record(c, models.AuditEntry{Action: action, Actor: user.Username, Reason: "mfa_pending"})
+		c.JSON(http.StatusOK, gin.H{"mfaRequired": true, "mfaToken": mfaToken, "mfaExpiration": mfaExpiration})
+		return true
+	}
+
+	return false
+}
+
+// rehashPassword replaces the stored hash with a hash using the current algorithm and parameters.
+// A failure is only logged, the login goes on with the old hash.
+func rehashPassword(user *models.User, password string) {
+	hashedPassword, err := passwords.Hash(password)
+	if err != nil {
+		fmt.Println("Error rehashing password of", user.Username, err)
+		return
+	}
+	if err := mongodb.RehashUserPassword(user.Username, user.Password, hashedPassword); err != nil {
+		fmt.Println("Error rehashing password of", user.Username, err)
+		return
+	}
+	user.Password = hashedPassword
 }
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/models"
+	"backend/internal/oidc"
+	"backend/internal/utils"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCStateTTL is the time left to log in on the identity provider
+const OIDCStateTTL = 10 * time.Minute
+
+// oidcCookie binds a pending login to the browser which started it
+const (
+	oidcCookie     = "rdj_oidc"
+	oidcCookiePath = "/auth/oidc"
+)
+
+// oidcTimeout bounds the calls to the identity provider during a login
+const oidcTimeout = 15 * time.Second
+
+// roleRank orders the roles, when several groups map to a role the highest wins
+var roleRank = map[string]int{models.RoleViewer: 1, models.RoleEditor: 2, models.RoleOwner: 3}
+
+// OIDCLogin starts an authorization code flow with PKCE and redirects the browser
+// to the identity provider
+func OIDCLogin(c *gin.Context) {
+	if oidc.Default == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "OIDC login is not configured"})
+		return
+	}
+
+	values := make([]string, 4)
+	for i := range values {
+		value, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not start login"})
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, codeVerifier, browser := values[0], values[1], values[2], values[3]
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), oidcTimeout)
+	defer cancel()
+
+	authURL, err := oidc.Default.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		fmt.Println("Error starting OIDC login", err)
+		c.JSON(http.StatusBadGateway, gin.H{"message": "Identity provider unavailable"})
+		return
+	}
+
+	now := time.Now().UTC()
+	err = mongodb.SaveOIDCState(models.OIDCState{
+		StateHash:    utils.HashToken(state),
+		BrowserHash:  utils.HashToken(browser),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(OIDCStateTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not start login"})
+		return
+	}
+
+	// Lax, the cookie must survive the redirects through the identity provider
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    browser,
+		Path:     oidcCookiePath,
+		Domain:   settings.Auth.CookieDomain,
+		MaxAge:   int(OIDCStateTTL.Seconds()),
+		Secure:   cookieSecure(),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback completes the login with the code and state received by the frontend
+// redirect page. The ID token is verified, the email checked against the allow-list,
+// then the linked user is logged in like with a password, second factor included.
+func OIDCCallback(c *gin.Context) {
+	if oidc.Default == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "OIDC login is not configured"})
+		return
+	}
+
+	var request models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" || request.State == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	state, err := mongodb.ConsumeOIDCState(utils.HashToken(request.State))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not complete login"})
+		return
+	}
+
+	browser, _ := c.Cookie(oidcCookie)
+	http.SetCookie(c.Writer, &http.Cookie{Name: oidcCookie, Path: oidcCookiePath, Domain: settings.Auth.CookieDomain, MaxAge: -1, Secure: cookieSecure(), HttpOnly: true})
+
+	if state == nil || subtle.ConstantTimeCompare([]byte(utils.HashToken(browser)), []byte(state.BrowserHash)) != 1 {
+		audit.Failure(c, models.AuditOIDCLogin, "", "invalid_state")
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired login, please try again"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), oidcTimeout)
+	defer cancel()
+
+	claims, err := oidc.Default.Exchange(ctx, request.Code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		fmt.Println("Error completing OIDC login", err)
+		audit.Failure(c, models.AuditOIDCLogin, "", "invalid_token")
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Could not verify the identity provider login"})
+		return
+	}
+
+	email := strings.ToLower(stripSpaces(claims.Email))
+	if email == "" || !claims.EmailVerified {
+		audit.Failure(c, models.AuditOIDCLogin, email, "email_not_verified")
+		c.JSON(http.StatusForbidden, gin.H{"message": "The identity provider did not verify the email"})
+		return
+	}
+	if !oidcEmailAllowed(email) {
+		audit.Failure(c, models.AuditOIDCLogin, email, "not_allowed")
+		c.JSON(http.StatusForbidden, gin.H{"message": "This account is not allowed"})
+		return
+	}
+
+	user, status, message := oidcUser(claims.Subject, email, oidcRole(claims))
+	if user == nil {
+		audit.Failure(c, models.AuditOIDCLogin, email, "link_failed")
+		c.JSON(status, gin.H{"message": message})
+		return
+	}
+	if user.Disabled {
+		audit.Failure(c, models.AuditOIDCLogin, user.Username, "disabled")
+		c.JSON(http.StatusForbidden, gin.H{"message": "Account disabled"})
+		return
+	}
+
+	// The identity provider is a first factor like a password
+	if secondFactorPending(c, user, models.AuditOIDCLogin) {
+		return
+	}
+
+	response, err := issueTokens(c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create token"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{
+		Action:  models.AuditOIDCLogin,
+		Actor:   user.Username,
+		Details: map[string]string{"email": email, "role": user.Role},
+	})
+
+	response["id"] = user.ID
+	response["user"] = user.Username
+	c.JSON(http.StatusOK, response)
+}
+
+// oidcUser returns the user linked to the provider account, or creates it. An existing user
+// with the same email is only linked with OIDC_LINK_BY_EMAIL, and never an owner: the
+// provider would take over the account. The role of linked users is synced when the
+// claims map to one, owners are managed in the admin area only.
+func oidcUser(subject, email, role string) (*models.User, int, string) {
+	user, err := mongodb.FindUserByOIDCSubject(subject)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Could not complete login"
+	}
+
+	if user == nil {
+		user, err = mongodb.FindUserByEmail(email, false)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Could not complete login"
+		}
+		if user != nil {
+			if user.OIDCSubject != "" {
+				return nil, http.StatusConflict, "This email is linked to another identity provider account"
+			}
+			if !settings.OIDC.LinkByEmail || user.Role == models.RoleOwner {
+				return nil, http.StatusConflict, "An account already uses this email, log in with its password"
+			}
+			if err := mongodb.LinkOIDCSubject(user.Username, subject); err != nil {
+				return nil, http.StatusInternalServerError, "Could not complete login"
+			}
+			fmt.Println("Linked the OIDC subject", subject, "to", user.Username)
+			user.OIDCSubject = subject
+		}
+	}
+
+	if user == nil {
+		now := time.Now().UTC()
+		user = &models.User{
+			Username:    email,
+			Email:       email,
+			Role:        role,
+			CreatedAt:   &now,
+			OIDCSubject: subject,
+		}
+		if user.Role == "" {
+			user.Role = oidcDefaultRole()
+		}
+
+		userId, err := mongodb.CreateUser(*user)
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Could not create user"
+		}
+		user.ID = userId
+		return user, http.StatusOK, ""
+	}
+
+	if role != "" && role != user.Role && user.Role != models.RoleOwner {
+		if err := mongodb.UpdateUserRole(user.ID, role, user.Permissions); err != nil {
+			fmt.Println("Error syncing the OIDC role of", user.Username, err)
+		} else {
+			InvalidatePrincipal(user.Username)
+			user.Role = role
+		}
+	}
+
+	return user, http.StatusOK, ""
+}
+
+// oidcEmailAllowed checks the email against OIDC_ALLOWED_EMAILS and OIDC_ALLOWED_DOMAINS.
+// Nobody is allowed when both are empty.
+func oidcEmailAllowed(email string) bool {
+	for _, allowed := range settings.OIDC.AllowedEmails {
+		if email == allowed {
+			return true
+		}
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+	for _, allowed := range settings.OIDC.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcRole maps the values of the OIDC_ROLE_CLAIM claim (default groups) with OIDC_ROLE_MAP,
+// a list of value=role pairs. It returns the highest mapped role, or "" when none matches.
+// The owner role is only given with OIDC_ALLOW_OWNER.
+func oidcRole(claims *oidc.Claims) string {
+	best := ""
+	for _, value := range claims.Values(settings.OIDC.RoleClaim) {
+		role, ok := settings.OIDC.RoleMap[value]
+		if !ok || (role == models.RoleOwner && !settings.OIDC.AllowOwner) {
+			continue
+		}
+		if roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	return best
+}
+
+// oidcDefaultRole is the role of the users created by an OIDC login when no group maps
+// to a role, OIDC_DEFAULT_ROLE or viewer
+func oidcDefaultRole() string {
+	role := settings.OIDC.DefaultRole
+	if !models.IsValidRole(role) || (role == models.RoleOwner && !settings.OIDC.AllowOwner) {
+		return models.RoleViewer
+	}
+	return role
+}
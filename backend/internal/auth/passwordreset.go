@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/mailer"
+	"backend/internal/models"
+	"backend/internal/passwords"
+	"backend/internal/utils"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PasswordResetTTL is how long a reset link can be used
+const PasswordResetTTL = 30 * time.Minute
+
+// ForgotPassword sends a reset link to the email if it belongs to an active user with a
+// password, passkey-only accounts get no link. The answer is the same in every case so the existence of a user is not leaked.
+func ForgotPassword(c *gin.Context) {
+	var request models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	email := strings.ToLower(stripSpaces(request.Email))
+	if !validateEmail(email) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "invalid email format", "fieldError": "email"})
+		return
+	}
+
+	response := gin.H{"message": "If the email is registered, a reset link has been sent"}
+
+	// Every request counts, so the same address or client cannot flood mailboxes
+	now := time.Now()
+	throttleKeys := forgotThrottleKeys(email, c.ClientIP())
+	if wait := loginRetryAfter(throttleKeys, now); wait > 0 {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	recordLoginFailure(throttleKeys, now)
+
+	user, err := mongodb.FindUserByEmail(email, false)
+	if err != nil || user == nil || user.Disabled || user.PasskeyOnly {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create reset link"})
+		return
+	}
+
+	err = mongodb.SavePasswordReset(models.PasswordReset{
+		TokenHash: utils.HashToken(token),
+		Username:  user.Username,
+		CreatedAt: now.UTC(),
+		ExpiresAt: now.UTC().Add(PasswordResetTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create reset link"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditPasswordForgot, Actor: user.Username})
+
+	// The mail is sent aside, the response time does not depend on the user existing
+	sendPasswordResetMail(user, token)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword sets a new password with a reset token. Refresh tokens are revoked
+// and access tokens issued before the reset are refused. Passkey-only accounts have no
+// password to reset, a link sent before passkey-only was enabled is refused.
+func ResetPassword(c *gin.Context) {
+	var request models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	password := stripSpaces(request.Password)
+	if err := validatePassword(password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error(), "fieldError": "password"})
+		return
+	}
+
+	// The token is checked first, invalid links do not cost a password hash
+	reset, err := mongodb.ConsumePasswordReset(utils.HashToken(stripSpaces(request.Token)))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not reset password"})
+		return
+	}
+	if reset == nil {
+		audit.Failure(c, models.AuditPasswordReset, "", "invalid_token")
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired reset link", "fieldError": "token"})
+		return
+	}
+
+	user, err := mongodb.FindUserByUsername(reset.Username, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not reset password"})
+		return
+	}
+	if user == nil || user.PasskeyOnly {
+		reason := "passkey_only"
+		if user == nil {
+			reason = "unknown_user"
+		}
+		audit.Failure(c, models.AuditPasswordReset, reset.Username, reason)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired reset link", "fieldError": "token"})
+		return
+	}
+
+	hashedPassword, err := passwords.Hash(password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not hash password"})
+		return
+	}
+
+	if err := mongodb.UpdateUserPassword(reset.Username, hashedPassword, time.Now().UTC()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not reset password"})
+		return
+	}
+	InvalidatePrincipal(reset.Username)
+	if err := mongodb.RevokeUserRefreshTokens(reset.Username); err != nil {
+		fmt.Println("Error revoking refresh tokens of", reset.Username, err)
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditPasswordReset, Actor: reset.Username})
+	c.JSON(http.StatusOK, gin.H{"message": "Password updated, please login again"})
+}
+
+// sendPasswordResetMail queues the mail with the reset link, the outbox sends it in background
+func sendPasswordResetMail(user *models.User, token string) {
+	mailer.Queue(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nOpen this link to choose a new password:\n%s\n\nThe link expires in %d minutes. "+
+			"If you did not ask for a reset, ignore this email.\n", user.Username, passwordResetURL(token), int(PasswordResetTTL.Minutes())),
+	})
+}
+
+// passwordResetURL returns the frontend page receiving the token, PASSWORD_RESET_URL
+// or the reset-password page of ALLOW_ORIGIN
+func passwordResetURL(token string) string {
+	base := settings.Auth.PasswordResetURL
+
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + "token=" + url.QueryEscape(token)
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"net/http"
+
+	"backend/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission returns a middleware that lets the request through only if the
+// authenticated user has the permission. It must run after JWTMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := CurrentClaims(c)
+		if claims == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Missing token"})
+			c.Abort()
+			return
+		}
+
+		if !claims.HasPermission(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Missing permission " + permission, "permission": permission})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// CurrentClaims returns the claims of the authenticated user set by JWTMiddleware, nil if none
+func CurrentClaims(c *gin.Context) *utils.JWTClaims {
+	value, exists := c.Get("user")
+	if !exists {
+		return nil
+	}
+	claims, _ := value.(*utils.JWTClaims)
+	return claims
+}
+
+// CurrentUsername returns the username of the authenticated user, empty if none
+func CurrentUsername(c *gin.Context) string {
+	if claims := CurrentClaims(c); claims != nil {
+		return claims.Username
+	}
+	return ""
+}
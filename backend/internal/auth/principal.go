@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"backend/internal/models"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrincipalCacheTTL bounds how long a user loaded by JWTMiddleware is reused. Changes made
+// through this instance invalidate it at once, the TTL only delays the other instances.
+const PrincipalCacheTTL = 30 * time.Second
+
+// maxCachedPrincipals bounds the cache, expired entries are dropped when it is full
+const maxCachedPrincipals = 1000
+
+// principalKey is the gin context key of the authenticated user
+const principalKey = "principal"
+
+type cachedPrincipal struct {
+	user      *models.User
+	expiresAt time.Time
+}
+
+var principals = struct {
+	sync.Mutex
+	entries map[string]cachedPrincipal
+}{entries: map[string]cachedPrincipal{}}
+
+// CurrentUser returns the authenticated user set by JWTMiddleware, nil for API keys and public routes.
+// The user is shared with other requests and must not be modified, it has no password nor secrets.
+func CurrentUser(c *gin.Context) *models.User {
+	value, exists := c.Get(principalKey)
+	if !exists {
+		return nil
+	}
+	user, _ := value.(*models.User)
+	return user
+}
+
+func setCurrentUser(c *gin.Context, user *models.User) {
+	c.Set(principalKey, user)
+}
+
+// InvalidatePrincipal drops the cached user, to call after changing its role, status or password
+func InvalidatePrincipal(username string) {
+	principals.Lock()
+	delete(principals.entries, username)
+	principals.Unlock()
+}
+
+// loadPrincipal returns the user from the cache, or from the database if missing or expired.
+// Unknown users are not cached.
+func loadPrincipal(username string) (*models.User, error) {
+	now := time.Now()
+
+	principals.Lock()
+	entry, ok := principals.entries[username]
+	principals.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.user, nil
+	}
+
+	user, err := mongodb.FindUserByUsername(username, false)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	user = principalOf(user)
+
+	principals.Lock()
+	if len(principals.entries) >= maxCachedPrincipals {
+		for key, cached := range principals.entries {
+			if !now.Before(cached.expiresAt) {
+				delete(principals.entries, key)
+			}
+		}
+		if len(principals.entries) >= maxCachedPrincipals {
+			principals.entries = map[string]cachedPrincipal{}
+		}
+	}
+	principals.entries[username] = cachedPrincipal{user: user, expiresAt: now.Add(PrincipalCacheTTL)}
+	principals.Unlock()
+
+	return user, nil
+}
+
+// principalOf copies the user without its password hash, second factor secrets and passkeys
+func principalOf(user *models.User) *models.User {
+	principal := *user
+	principal.Password = ""
+	principal.TOTPSecret = ""
+	principal.TOTPPendingSecret = ""
+	principal.RecoveryCodes = nil
+	principal.WebAuthnCredentials = nil
+	principal.Permissions = append([]string(nil), user.Permissions...)
+	return &principal
+}
@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"backend/internal/cors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Route policies, every route is registered with one of them. The preflight routes are
+// added by the router for the CORS policy of the group.
+const (
+	PolicyPublic        = "public"
+	PolicyAuthenticated = "authenticated"
+	PolicyPreflight     = "preflight"
+)
+
+// PermissionPolicy is the policy of the routes requiring a permission
+func PermissionPolicy(permission string) string {
+	return "permission:" + permission
+}
+
+// Router registers the routes with an explicit policy, a route cannot be added without
+// deciding who may call it. CheckPolicies finds the routes registered around it.
+type Router struct {
+	engine   *gin.Engine
+	policies map[string]string
+	cors     *cors.Policy
+	// CORS policy of each method of each path, answering the preflight requests
+	preflights map[string]map[string]*cors.Policy
+}
+
+// RouteGroup is a set of routes sharing a path prefix, a policy and a CORS policy
+type RouteGroup struct {
+	router *Router
+	group  *gin.RouterGroup
+	policy string
+	cors   *cors.Policy
+}
+
+// NewRouter wraps the engine, routes must then be registered through the groups of the router.
+// Their CORS policy is corsPolicy, unless registered through WithCORS.
+func NewRouter(engine *gin.Engine, corsPolicy *cors.Policy) *Router {
+	return &Router{engine: engine, policies: map[string]string{}, cors: corsPolicy, preflights: map[string]map[string]*cors.Policy{}}
+}
+
+// WithCORS returns a router registering its routes on the same engine with another CORS policy
+func (r *Router) WithCORS(corsPolicy *cors.Policy) *Router {
+	router := *r
+	router.cors = corsPolicy
+	return &router
+}
+
+// Public returns a group of routes anyone can call
+func (r *Router) Public(relativePath string) *RouteGroup {
+	return r.newGroup(relativePath, PolicyPublic)
+}
+
+// Authenticated returns a group of routes requiring a valid token or API key
+func (r *Router) Authenticated(relativePath string) *RouteGroup {
+	return r.newGroup(relativePath, PolicyAuthenticated, JWTMiddleware)
+}
+
+// Permission returns a group of routes requiring a valid token or API key granting the permission
+func (r *Router) Permission(relativePath string, permission string) *RouteGroup {
+	return r.newGroup(relativePath, PermissionPolicy(permission), JWTMiddleware, RequirePermission(permission))
+}
+
+// newGroup creates the group, the CORS headers are added before the authentication so
+// the frontend can read its errors
+func (r *Router) newGroup(relativePath, policy string, handlers ...gin.HandlerFunc) *RouteGroup {
+	if r.cors != nil {
+		handlers = append([]gin.HandlerFunc{r.cors.Middleware()}, handlers...)
+	}
+	return &RouteGroup{router: r, group: r.engine.Group(relativePath, handlers...), policy: policy, cors: r.cors}
+}
+
+func (g *RouteGroup) GET(relativePath string, handlers ...gin.HandlerFunc) {
+	g.handle(http.MethodGet, relativePath, handlers)
+}
+
+func (g *RouteGroup) HEAD(relativePath string, handlers ...gin.HandlerFunc) {
+	g.handle(http.MethodHead, relativePath, handlers)
+}
+
+func (g *RouteGroup) POST(relativePath string, handlers ...gin.HandlerFunc) {
+	g.handle(http.MethodPost, relativePath, handlers)
+}
+
+func (g *RouteGroup) PUT(relativePath string, handlers ...gin.HandlerFunc) {
+	g.handle(http.MethodPut, relativePath, handlers)
+}
+
+func (g *RouteGroup) DELETE(relativePath string, handlers ...gin.HandlerFunc) {
+	g.handle(http.MethodDelete, relativePath, handlers)
+}
+
+func (g *RouteGroup) handle(method, relativePath string, handlers []gin.HandlerFunc) {
+	fullPath := joinPaths(g.group.BasePath(), relativePath)
+	g.group.Handle(method, relativePath, handlers...)
+	g.router.policies[method+" "+fullPath] = g.policy
+
+	if g.cors != nil {
+		g.router.addPreflight(method, fullPath, g.cors)
+	}
+}
+
+// addPreflight registers the OPTIONS route of the path on its first route, the preflight
+// answers with the CORS policy of the requested method
+func (r *Router) addPreflight(method, fullPath string, corsPolicy *cors.Policy) {
+	methods, ok := r.preflights[fullPath]
+	if !ok {
+		methods = map[string]*cors.Policy{}
+		r.preflights[fullPath] = methods
+		r.engine.OPTIONS(fullPath, cors.Preflight(methods))
+		r.policies[http.MethodOptions+" "+fullPath] = PolicyPreflight
+	}
+	methods[method] = corsPolicy
+}
+
+// CheckPolicies returns an error listing the routes without a policy, registered on the
+// engine directly instead of through the router
+func (r *Router) CheckPolicies() error {
+	missing := []string{}
+	for _, route := range r.engine.Routes() {
+		if _, ok := r.policies[route.Method+" "+route.Path]; !ok {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("routes registered without policy: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// PolicyTable returns the routes with their policy and handler as a markdown table, sorted by path
+func (r *Router) PolicyTable() string {
+	routes := r.engine.Routes()
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	var table strings.Builder
+	table.WriteString("| Method | Path | Policy | Handler |\n")
+	table.WriteString("|---|---|---|---|\n")
+	for _, route := range routes {
+		policy, ok := r.policies[route.Method+" "+route.Path]
+		if !ok {
+			policy = "**missing**"
+		}
+		fmt.Fprintf(&table, "| %s | `%s` | %s | `%s` |\n", route.Method, route.Path, policy, route.Handler)
+	}
+	return table.String()
+}
+
+// joinPaths joins a group path and a route path like gin does, keeping the trailing slash
+func joinPaths(basePath, relativePath string) string {
+	if relativePath == "" {
+		return basePath
+	}
+	joined := path.Join(basePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/models"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SessionTouchInterval limits the last seen updates, a session is written at most once per interval
+const SessionTouchInterval = time.Minute
+
+// maxUserAgentLength bounds the user agent stored with a session
+const maxUserAgentLength = 256
+
+// ListSessions returns the active sessions of the current user, flagging the one of the request
+func ListSessions(c *gin.Context) {
+	claims := CurrentClaims(c)
+	if claims == nil || claims.Username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Missing token"})
+		return
+	}
+
+	sessions, err := mongodb.ListUserSessions(claims.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not list sessions"})
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == claims.SessionID
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession signs a session of the current user out: its refresh tokens are revoked
+// and its access tokens refused from the next request
+func RevokeSession(c *gin.Context) {
+	claims := CurrentClaims(c)
+	if claims == nil || claims.Username == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Missing token"})
+		return
+	}
+
+	session, err := mongodb.FindSession(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not revoke session"})
+		return
+	}
+	if session == nil || session.Username != claims.Username || session.RevokedAt != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Session not found"})
+		return
+	}
+
+	if err := mongodb.RevokeRefreshFamily(session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not revoke session"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{
+		Action:  models.AuditSessionRevoke,
+		Details: map[string]string{"session": session.ID, "ip": session.IP, "current": fmt.Sprint(session.ID == claims.SessionID)},
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// touchSession records the activity of the session, once per SessionTouchInterval
+func touchSession(c *gin.Context, session *models.Session) {
+	now := time.Now().UTC()
+	if now.Sub(session.LastSeenAt) < SessionTouchInterval {
+		return
+	}
+	if err := mongodb.TouchSession(session.ID, c.ClientIP(), sessionUserAgent(c), now, SessionTouchInterval); err != nil {
+		fmt.Println("Error updating session", err)
+	}
+}
+
+func sessionUserAgent(c *gin.Context) string {
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
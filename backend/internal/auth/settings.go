@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"backend/internal/config"
+	"backend/internal/passwords"
+	"backend/internal/utils"
+)
+
+// settings is the configuration of the package, set on startup by Configure
+var settings = &config.Config{}
+
+// Configure sets the configuration of the authentication, including the token secrets of
+// utils and the password hash parameters. It must run before the root user is created.
+func Configure(cfg *config.Config) {
+	settings = cfg
+	utils.Configure(cfg.Auth.JWTSecret.Value(), cfg.Auth.IPHashSecret.Value(), cfg.AppName)
+	passwords.SetParams(cfg.Auth.Argon2)
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/passwords"
+	"backend/internal/utils"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Login throttling: attempts and failures are counted per identifier and per IP in a
+// window starting with the first attempt. Past the free failures each new one doubles the
+// wait before the next attempt, reaching the limit locks the key for LoginLockout.
+// Attempts are counted before the credentials are checked, so concurrent requests
+// cannot run more than the limit of checks either.
+const (
+	LoginWindow  = 15 * time.Minute
+	LoginLockout = 15 * time.Minute
+	loginBackoff = time.Second
+)
+
+type loginLimit struct {
+	prefix string
+	free   int // failures allowed before the backoff starts
+	max    int // failures that lock the key
+}
+
+var (
+	identifierLimit = loginLimit{prefix: "identifier", free: 2, max: 5}
+	ipLimit         = loginLimit{prefix: "ip", free: 10, max: 20}
+
+	// Reset requests have their own buckets, flooding them must not lock the logins
+	forgotEmailLimit = loginLimit{prefix: "forgot", free: 1, max: 3}
+	forgotIPLimit    = loginLimit{prefix: "forgot-ip", free: 3, max: 10}
+)
+
+type loginThrottleKey struct {
+	key   string
+	limit loginLimit
+}
+
+// loginThrottleKeys returns the keys checked for a login attempt, hashed so the
+// collection holds neither identifiers nor addresses
+func loginThrottleKeys(identifier, ip string) []loginThrottleKey {
+	return []loginThrottleKey{
+		{key: identifierLimit.prefix + ":" + utils.HashToken(strings.ToLower(identifier)), limit: identifierLimit},
+		{key: ipLimit.prefix + ":" + utils.HashIP(ip), limit: ipLimit},
+	}
+}
+
+// forgotThrottleKeys returns the keys checked for a password reset request
+func forgotThrottleKeys(email, ip string) []loginThrottleKey {
+	return []loginThrottleKey{
+		{key: forgotEmailLimit.prefix + ":" + utils.HashToken(strings.ToLower(email)), limit: forgotEmailLimit},
+		{key: forgotIPLimit.prefix + ":" + utils.HashIP(ip), limit: forgotIPLimit},
+	}
+}
+
+// loginRetryAfter counts the attempt on every key and returns how long it has to wait,
+// 0 if it can go on. A refused attempt is not counted.
+func loginRetryAfter(keys []loginThrottleKey, now time.Time) time.Duration {
+	var wait time.Duration
+	counted := []loginThrottleKey{}
+	for _, k := range keys {
+		throttle, err := mongodb.AddLoginAttempt(k.key, now.Add(LoginWindow))
+		if err != nil {
+			fmt.Println("Error counting login attempt", err)
+			continue
+		}
+		counted = append(counted, k)
+
+		remaining := throttle.LockedUntil.Sub(now)
+		// More attempts than the limit are running at once, the next one waits for their outcome
+		if throttle.Attempts > k.limit.max && remaining < loginBackoff {
+			remaining = loginBackoff
+		}
+		if remaining > wait {
+			wait = remaining
+		}
+	}
+
+	if wait > 0 {
+		releaseLoginAttempts(counted)
+	}
+	return wait
+}
+
+// recordLoginFailure counts a failed attempt on every key and sets their backoff
+func recordLoginFailure(keys []loginThrottleKey, now time.Time) {
+	for _, k := range keys {
+		throttle, err := mongodb.RecordLoginFailure(k.key)
+		if err != nil {
+			fmt.Println("Error recording login failure", err)
+			continue
+		}
+		if throttle == nil {
+			continue
+		}
+
+		if delay := loginDelay(k.limit, throttle.Failures); delay > 0 {
+			if err := mongodb.SetLoginLockout(k.key, now.Add(delay), throttle.Failures >= k.limit.max); err != nil {
+				fmt.Println("Error locking login", err)
+			}
+		}
+	}
+}
+
+func releaseLoginAttempts(keys []loginThrottleKey) {
+	for _, k := range keys {
+		if err := mongodb.ReleaseLoginAttempt(k.key); err != nil {
+			fmt.Println("Error releasing login attempt", err)
+		}
+	}
+}
+
+// loginDelay returns the wait imposed after the given number of failures in the window
+func loginDelay(limit loginLimit, failures int) time.Duration {
+	if failures >= limit.max {
+		return LoginLockout
+	}
+	if failures <= limit.free {
+		return 0
+	}
+	delay := loginBackoff * time.Duration(math.Pow(2, float64(failures-limit.free-1)))
+	if delay > LoginLockout {
+		return LoginLockout
+	}
+	return delay
+}
+
+// clearLoginFailures resets the identifier after a successful login. On the IP only the
+// attempt is released, a valid account must not hide failures on other ones.
+func clearLoginFailures(keys []loginThrottleKey) {
+	for _, k := range keys {
+		if k.limit.prefix != identifierLimit.prefix {
+			releaseLoginAttempts([]loginThrottleKey{k})
+			continue
+		}
+		if err := mongodb.ClearLoginFailures(k.key); err != nil {
+			fmt.Println("Error clearing login failures", err)
+		}
+	}
+}
+
+// rejectLogin sends the generic invalid credentials response, the same for unknown,
+// wrong password and throttled attempts so the existence of a user is not leaked
+func rejectLogin(c *gin.Context, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		c.Header("Retry-After", fmt.Sprint(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	c.JSON(http.StatusForbidden, gin.H{"message": "Invalid credentials", "fieldError": "unauthorized"})
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// compareDummyPassword spends the time of a password verification when the user does
+// not exist, so response times do not reveal it either
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = passwords.Hash("dummy-password")
+	})
+	passwords.Verify(password, dummyHash)
+}
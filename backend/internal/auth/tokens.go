@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RefreshTokenTTL is the lifetime of a refresh token. Each refresh rotates it.
+const RefreshTokenTTL = 7 * 24 * time.Hour
+
+// issueTokens creates an access token and a refresh token for the user.
+// An empty family starts a new one, refreshes keep the family of the token they replace.
+// The family is also the session, recorded with the client of the request.
+// In cookie mode the tokens are set as cookies instead of being returned.
+func issueTokens(c *gin.Context, user *models.User, family string) (gin.H, error) {
+	var err error
+	if family == "" {
+		family, err = utils.GenerateRandomToken(16)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	token, expiration, err := utils.GenerateJWT(user, family)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	err = mongodb.UpsertSession(models.Session{
+		ID:         family,
+		Username:   user.Username,
+		UserAgent:  sessionUserAgent(c),
+		IP:         c.ClientIP(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = mongodb.SaveRefreshToken(models.RefreshToken{
+		TokenHash: utils.HashToken(refreshToken),
+		Family:    family,
+		Username:  user.Username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response := gin.H{
+		"token":             token,
+		"expiration":        expiration,
+		"refreshToken":      refreshToken,
+		"refreshExpiration": now.Add(RefreshTokenTTL).Unix(),
+		"role":              user.Role,
+		"permissions":       user.EffectivePermissions(),
+	}
+
+	if cookieMode() {
+		if err := setSessionCookies(c, response); err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh token.
+// A refresh token can be used once, presenting it again revokes the whole family.
+func Refresh(c *gin.Context) {
+	var request models.RefreshRequest
+	_ = c.ShouldBindJSON(&request)
+
+	// In cookie mode the refresh token comes from its cookie, with the CSRF token
+	if request.RefreshToken == "" {
+		request.RefreshToken = sessionCookie(c, RefreshCookie)
+		if request.RefreshToken != "" && !validCSRF(c) {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Invalid CSRF token"})
+			return
+		}
+	}
+	if request.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Refresh token required", "fieldError": "refreshToken"})
+		return
+	}
+
+	tokenHash := utils.HashToken(request.RefreshToken)
+	stored, err := mongodb.FindRefreshToken(tokenHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not refresh token"})
+		return
+	}
+	if stored == nil || time.Now().After(stored.ExpiresAt) {
+		audit.Failure(c, models.AuditRefresh, "", "invalid_token")
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid refresh token"})
+		return
+	}
+
+	marked, err := mongodb.MarkRefreshTokenUsed(tokenHash)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not refresh token"})
+		return
+	}
+	if !marked {
+		// Reuse of a rotated or revoked token: someone else may hold a copy
+		if err := mongodb.RevokeRefreshFamily(stored.Family); err != nil {
+			fmt.Println("Error revoking refresh token family", err)
+		}
+		audit.Failure(c, models.AuditRefresh, stored.Username, "reused_token")
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid refresh token"})
+		return
+	}
+
+	user, err := mongodb.FindUserByUsername(stored.Username, false)
+	if err != nil || user == nil || user.Disabled {
+		audit.Failure(c, models.AuditRefresh, stored.Username, "disabled")
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid refresh token"})
+		return
+	}
+
+	response, err := issueTokens(c, user, stored.Family)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create token"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditRefresh, Actor: user.Username})
+
+	response["id"] = user.ID
+	response["user"] = user.Username
+	c.JSON(http.StatusOK, response)
+}
+
+// Logout revokes the access token sent in the Authorization header and the
+// family of the refresh token sent in the body, or their cookies. Both are optional,
+// so an expired access token does not prevent logging out.
+func Logout(c *gin.Context) {
+	actor := ""
+	fromCookie := false
+	tokenString := utils.RetriveTokenFromRequestHttp(c)
+	if tokenString == nil {
+		if cookie := sessionCookie(c, SessionCookie); cookie != "" {
+			tokenString = &cookie
+			fromCookie = true
+		}
+	}
+
+	var request models.RefreshRequest
+	_ = c.ShouldBindJSON(&request)
+	if request.RefreshToken == "" {
+		request.RefreshToken = sessionCookie(c, RefreshCookie)
+		fromCookie = fromCookie || request.RefreshToken != ""
+	}
+
+	// Browsers send the cookies with cross-site requests too, the CSRF token proves the origin
+	if fromCookie && !validCSRF(c) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Invalid CSRF token"})
+		return
+	}
+
+	if tokenString != nil {
+		if claims, err := utils.ValidateJWT(*tokenString); err == nil && claims.ID != "" {
+			actor = claims.Username
+			if err := mongodb.RevokeAccessToken(claims.ID, claims.ExpiresAt.Time); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not logout"})
+				return
+			}
+			if claims.SessionID != "" {
+				if err := mongodb.RevokeRefreshFamily(claims.SessionID); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not logout"})
+					return
+				}
+			}
+		}
+	}
+
+	if request.RefreshToken != "" {
+		stored, err := mongodb.FindRefreshToken(utils.HashToken(request.RefreshToken))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not logout"})
+			return
+		}
+		if stored != nil {
+			actor = stored.Username
+			if err := mongodb.RevokeRefreshFamily(stored.Family); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not logout"})
+				return
+			}
+		}
+	}
+
+	if cookieMode() {
+		clearSessionCookies(c)
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditLogout, Actor: actor})
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/models"
+	"backend/internal/passwords"
+	"backend/internal/utils"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecoveryCodesCount is the number of one-time recovery codes given at enrolment
+const RecoveryCodesCount = 10
+
+// RecentLoginWindow is the time after a login during which the second factor and the
+// passkeys can be changed without entering the password again
+const RecentLoginWindow = 5 * time.Minute
+
+// EnrollTOTP starts the enrolment of the current user: the secret is kept pending
+// until ConfirmTOTP receives a valid code generated from it
+func EnrollTOTP(c *gin.Context) {
+	var request models.TOTPEnrollRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok || !reauthenticated(c, user, request.Password) {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"message": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create secret"})
+		return
+	}
+	if err := mongodb.SetPendingTOTPSecret(user.Username, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret": secret,
+		"uri":    utils.TOTPURI(totpIssuer(), user.Username, secret),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication and returns the recovery codes, shown only once
+func ConfirmTOTP(c *gin.Context) {
+	var request models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok || !reauthenticated(c, user, request.Password) {
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "No two-factor enrolment in progress"})
+		return
+	}
+
+	step := utils.ValidateTOTP(user.TOTPPendingSecret, request.Code, time.Now())
+	if step == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid code", "fieldError": "code"})
+		return
+	}
+
+	recoveryCodes, err := utils.GenerateRecoveryCodes(RecoveryCodesCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create recovery codes"})
+		return
+	}
+	hashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		hashes = append(hashes, utils.HashRecoveryCode(code))
+	}
+
+	if err := mongodb.EnableTOTP(user.Username, user.TOTPPendingSecret, step, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not enable two-factor authentication"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditTOTPEnable, Target: user.Username})
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recoveryCodes": recoveryCodes})
+}
+
+// DisableTOTP removes the second factor, it requires the password, or a recent login, and a valid code
+func DisableTOTP(c *gin.Context) {
+	var request models.TOTPDisableRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !reauthenticated(c, user, request.Password) {
+		return
+	}
+
+	valid, err := verifySecondFactor(user, request.Code, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not verify code"})
+		return
+	}
+	if !valid {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Invalid code", "fieldError": "code"})
+		return
+	}
+
+	if err := mongodb.DisableTOTP(user.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not disable two-factor authentication"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditTOTPDisable, Target: user.Username})
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// VerifyMFA completes a login: it exchanges the MFA token returned by Login and a
+// TOTP or recovery code for the access and refresh tokens
+func VerifyMFA(c *gin.Context) {
+	var request models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	claims, err := utils.ValidateMFAToken(request.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired MFA token", "fieldError": "mfaToken"})
+		return
+	}
+
+	// An MFA token is accepted once, after a wrong code the user logs in again
+	consumed, err := mongodb.ConsumeTokenID(claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not verify code"})
+		return
+	}
+	if !consumed {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired MFA token", "fieldError": "mfaToken"})
+		return
+	}
+
+	user, err := mongodb.FindUserByUsername(claims.Username, false)
+	if err != nil || user == nil || user.Disabled || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid or expired MFA token", "fieldError": "mfaToken"})
+		return
+	}
+
+	// Codes are throttled separately from passwords, a correct password does not reset them
+	now := time.Now()
+	throttleKeys := loginThrottleKeys("mfa:"+user.Username, c.ClientIP())
+	if wait := loginRetryAfter(throttleKeys, now); wait > 0 {
+		audit.Failure(c, models.AuditMFA, user.Username, "throttled")
+		c.Header("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusForbidden, gin.H{"message": "Invalid code", "fieldError": "code"})
+		return
+	}
+
+	valid, err := verifySecondFactor(user, request.Code, request.RecoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not verify code"})
+		return
+	}
+	if !valid {
+		recordLoginFailure(throttleKeys, now)
+		audit.Failure(c, models.AuditMFA, user.Username, "invalid_code")
+		c.JSON(http.StatusForbidden, gin.H{"message": "Invalid code", "fieldError": "code"})
+		return
+	}
+	clearLoginFailures(throttleKeys)
+
+	response, err := issueTokens(c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create token"})
+		return
+	}
+
+	reason := "totp"
+	if stripSpaces(request.RecoveryCode) != "" {
+		reason = "recovery_code"
+	}
+	audit.Record(c, models.AuditEntry{Action: models.AuditMFA, Actor: user.Username, Reason: reason})
+
+	response["id"] = user.ID
+	response["user"] = user.Username
+	c.JSON(http.StatusOK, response)
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code when given.
+// Accepted TOTP steps and recovery codes cannot be used again.
+func verifySecondFactor(user *models.User, code string, recoveryCode string) (bool, error) {
+	if stripSpaces(recoveryCode) != "" {
+		return mongodb.ConsumeRecoveryCode(user.Username, utils.HashRecoveryCode(recoveryCode))
+	}
+
+	step := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if step == 0 {
+		return false, nil
+	}
+	return mongodb.MarkTOTPStepUsed(user.Username, step)
+}
+
+// reauthenticated checks the password entered again, users who logged in less than
+// RecentLoginWindow ago may leave it empty. It writes the error response on failure.
+func reauthenticated(c *gin.Context, user *models.User, password string) bool {
+	if password = stripSpaces(password); password != "" {
+		if match, _ := passwords.Verify(password, user.Password); match {
+			return true
+		}
+		c.JSON(http.StatusForbidden, gin.H{"message": "Invalid credentials", "fieldError": "password"})
+		return false
+	}
+
+	if claims := CurrentClaims(c); claims != nil && claims.SessionID != "" {
+		session, err := mongodb.FindSession(claims.SessionID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not verify credentials"})
+			return false
+		}
+		if session != nil && session.RevokedAt == nil && time.Since(session.CreatedAt) < RecentLoginWindow {
+			return true
+		}
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{"message": "Enter your password again", "fieldError": "password"})
+	return false
+}
+
+// currentUser loads the authenticated user, writing the error response if missing
+func currentUser(c *gin.Context) (*models.User, bool) {
+	claims := CurrentClaims(c)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Missing token"})
+		return nil, false
+	}
+
+	user, err := mongodb.FindUserByUsername(claims.Username, false)
+	if err != nil || user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User not found"})
+		return nil, false
+	}
+	return user, true
+}
+
+// totpIssuer is TOTP_ISSUER, APP_NAME or retro-dev-journey
+func totpIssuer() string {
+	if settings.Auth.TOTPIssuer != "" {
+		return settings.Auth.TOTPIssuer
+	}
+	return "retro-dev-journey"
+}
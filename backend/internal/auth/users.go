@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"backend/internal/audit"
+	"backend/internal/models"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ListUsers returns every user of the admin area
+func ListUsers(c *gin.Context) {
+	users, err := mongodb.ListUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not list users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// ChangeUserRole sets the role and the extra permissions of a user
+func ChangeUserRole(c *gin.Context) {
+	var request models.RoleUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	request.Role = stripSpaces(request.Role)
+	if !models.IsValidRole(request.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid role", "fieldError": "role"})
+		return
+	}
+	for _, permission := range request.Permissions {
+		if !models.IsValidPermission(permission) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid permission " + permission, "fieldError": "permissions"})
+			return
+		}
+	}
+
+	if !canGrant(c, request.Role, request.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only an owner can grant user management"})
+		return
+	}
+
+	user, ok := targetUser(c)
+	if !ok || !canManage(c, user) {
+		return
+	}
+
+	if user.Role == models.RoleOwner && request.Role != models.RoleOwner {
+		if ok := keepAnOwner(c); !ok {
+			return
+		}
+	}
+
+	if err := mongodb.UpdateUserRole(user.ID, request.Role, request.Permissions); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update user"})
+		return
+	}
+	InvalidatePrincipal(user.Username)
+
+	audit.Record(c, models.AuditEntry{
+		Action:  models.AuditUserRole,
+		Target:  user.Username,
+		Details: map[string]string{"from": user.Role, "to": request.Role, "permissions": strings.Join(request.Permissions, ",")},
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated", "role": request.Role})
+}
+
+// DisableUser blocks a user and revokes its refresh tokens, the access tokens
+// stop working on the next request since JWTMiddleware checks the account
+func DisableUser(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok || !canManage(c, user) {
+		return
+	}
+	if isCurrentUser(c, user) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "You cannot disable your own account"})
+		return
+	}
+	if user.Role == models.RoleOwner && !user.Disabled {
+		if ok := keepAnOwner(c); !ok {
+			return
+		}
+	}
+
+	if err := mongodb.SetUserDisabled(user.ID, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not disable user"})
+		return
+	}
+	InvalidatePrincipal(user.Username)
+	if err := mongodb.RevokeUserRefreshTokens(user.Username); err != nil {
+		fmt.Println("Error revoking refresh tokens of", user.Username, err)
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditUserDisable, Target: user.Username})
+	c.JSON(http.StatusOK, gin.H{"message": "User disabled"})
+}
+
+// EnableUser lets a disabled user log in again
+func EnableUser(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok || !canManage(c, user) {
+		return
+	}
+
+	if err := mongodb.SetUserDisabled(user.ID, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not enable user"})
+		return
+	}
+	InvalidatePrincipal(user.Username)
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditUserEnable, Target: user.Username})
+	c.JSON(http.StatusOK, gin.H{"message": "User enabled"})
+}
+
+// DeleteUser removes a user and revokes its refresh tokens
+func DeleteUser(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok || !canManage(c, user) {
+		return
+	}
+	if isCurrentUser(c, user) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "You cannot delete your own account"})
+		return
+	}
+	if user.Role == models.RoleOwner && !user.Disabled {
+		if ok := keepAnOwner(c); !ok {
+			return
+		}
+	}
+
+	if err := mongodb.DeleteUser(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not delete user"})
+		return
+	}
+	InvalidatePrincipal(user.Username)
+	if err := mongodb.RevokeUserRefreshTokens(user.Username); err != nil {
+		fmt.Println("Error revoking refresh tokens of", user.Username, err)
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditUserDelete, Target: user.Username})
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// targetUser loads the user of the :id route parameter, writing the error response if missing
+func targetUser(c *gin.Context) (*models.User, bool) {
+	user, err := mongodb.FindUserById(c.Param("id"))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user id"})
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+// keepAnOwner refuses changes that would leave the admin area without an active owner
+func keepAnOwner(c *gin.Context) bool {
+	owners, err := mongodb.CountActiveOwners()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update user"})
+		return false
+	}
+	if owners <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"message": "At least one active owner is required"})
+		return false
+	}
+	return true
+}
+
+func isCurrentUser(c *gin.Context, user *models.User) bool {
+	claims := CurrentClaims(c)
+	return claims != nil && claims.Username == user.Username
+}
+
+// isOwner reports whether the current user is an owner, from its account rather than
+// from the role in the access token which may predate a demotion
+func isOwner(c *gin.Context) bool {
+	if user := CurrentUser(c); user != nil {
+		return user.Role == models.RoleOwner
+	}
+	claims := CurrentClaims(c)
+	return claims != nil && claims.Role == models.RoleOwner
+}
+
+// canManage refuses, writing the error response, any change to an owner or to a user
+// managing users unless the current user is an owner
+func canManage(c *gin.Context, user *models.User) bool {
+	if isOwner(c) || (user.Role != models.RoleOwner && !slices.Contains(user.EffectivePermissions(), models.PermissionUsersManage)) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"message": "Only an owner can change an owner or a user manager"})
+	return false
+}
+
+// canGrant reports whether the current user may give the role and permissions.
+// Owner role and user management can only be granted by an owner.
+func canGrant(c *gin.Context, role string, permissions []string) bool {
+	if isOwner(c) {
+		return true
+	}
+	if role == models.RoleOwner {
+		return false
+	}
+	for _, permission := range permissions {
+		if permission == models.PermissionUsersManage {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,412 @@
+package auth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/models"
+	"backend/internal/utils"
+	"backend/internal/webauthn"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WebAuthnChallengeTTL is the time left to complete a passkey ceremony
+const WebAuthnChallengeTTL = 5 * time.Minute
+
+// MaxPasskeys is the number of passkeys a user can register
+const MaxPasskeys = 10
+
+// Ceremonies of a WebAuthn challenge
+const (
+	ceremonyRegister = "register"
+	ceremonyLogin    = "login"
+)
+
+// BeginPasskeyRegistration returns the options of navigator.credentials.create for the current user,
+// it requires the password or a recent login like the changes of the second factor
+func BeginPasskeyRegistration(c *gin.Context) {
+	if !webauthnEnabled(c) {
+		return
+	}
+
+	var request models.PasskeyPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok || !reauthenticated(c, user, request.Password) {
+		return
+	}
+	if len(user.WebAuthnCredentials) >= MaxPasskeys {
+		c.JSON(http.StatusConflict, gin.H{"message": fmt.Sprintf("At most %d passkeys can be registered", MaxPasskeys)})
+		return
+	}
+
+	challenge, ok := newWebAuthnChallenge(c, ceremonyRegister, user.Username)
+	if !ok {
+		return
+	}
+
+	algorithms := []gin.H{}
+	for _, algorithm := range webauthn.SupportedAlgorithms {
+		algorithms = append(algorithms, gin.H{"type": "public-key", "alg": algorithm})
+	}
+	excluded := []gin.H{}
+	for _, credential := range user.WebAuthnCredentials {
+		excluded = append(excluded, gin.H{"type": "public-key", "id": credential.ID})
+	}
+
+	// Discoverable credentials with user verification, the passkey alone can log in
+	c.JSON(http.StatusOK, gin.H{"publicKey": gin.H{
+		"challenge": challenge,
+		"rp":        gin.H{"id": webauthn.Default.ID, "name": webauthn.Default.Name},
+		"user": gin.H{
+			"id":          base64.RawURLEncoding.EncodeToString([]byte(user.ID)),
+			"name":        user.Username,
+			"displayName": user.Username,
+		},
+		"pubKeyCredParams": algorithms,
+		"timeout":          WebAuthnChallengeTTL.Milliseconds(),
+		"attestation":      "none",
+		"authenticatorSelection": gin.H{
+			"residentKey":        "required",
+			"requireResidentKey": true,
+			"userVerification":   "required",
+		},
+		"excludeCredentials": excluded,
+	}})
+}
+
+// FinishPasskeyRegistration verifies the new credential and adds it to the current user
+func FinishPasskeyRegistration(c *gin.Context) {
+	if !webauthnEnabled(c) {
+		return
+	}
+
+	var request models.WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok || !reauthenticated(c, user, request.Password) {
+		return
+	}
+
+	clientDataJSON, err1 := decodeBase64URL(request.Credential.Response.ClientDataJSON)
+	attestationObject, err2 := decodeBase64URL(request.Credential.Response.AttestationObject)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid credential", "fieldError": "credential"})
+		return
+	}
+
+	challenge, ok := consumeWebAuthnChallenge(c, clientDataJSON, ceremonyRegister)
+	if !ok {
+		return
+	}
+	if challenge.Username != user.Username {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired registration, please try again"})
+		return
+	}
+
+	credential, err := webauthn.Default.VerifyRegistration(clientDataJSON, attestationObject, challenge.value)
+	if err != nil {
+		fmt.Println("Error verifying passkey registration", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Could not verify the passkey", "fieldError": "credential"})
+		return
+	}
+
+	name := stripSpaces(request.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	stored := models.WebAuthnCredential{
+		ID:         base64.RawURLEncoding.EncodeToString(credential.ID),
+		Name:       name,
+		PublicKey:  credential.PublicKey,
+		Algorithm:  credential.Algorithm,
+		SignCount:  credential.SignCount,
+		Transports: request.Credential.Response.Transports,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := mongodb.AddWebAuthnCredential(user.Username, stored); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": "Could not register the passkey"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditPasskeyRegister, Details: map[string]string{"credential": stored.ID, "name": name}})
+	c.JSON(http.StatusCreated, gin.H{"message": "Passkey registered", "credential": stored})
+}
+
+// BeginPasskeyLogin returns the options of navigator.credentials.get. The credential is
+// discoverable, the authenticator lets the user pick the account.
+func BeginPasskeyLogin(c *gin.Context) {
+	if !webauthnEnabled(c) {
+		return
+	}
+
+	challenge, ok := newWebAuthnChallenge(c, ceremonyLogin, "")
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": gin.H{
+		"challenge":        challenge,
+		"rpId":             webauthn.Default.ID,
+		"timeout":          WebAuthnChallengeTTL.Milliseconds(),
+		"userVerification": "required",
+		"allowCredentials": []gin.H{},
+	}})
+}
+
+// FinishPasskeyLogin verifies the assertion and logs the owner of the credential in.
+// A verified passkey is a complete login, no password nor second factor is asked.
+func FinishPasskeyLogin(c *gin.Context) {
+	if !webauthnEnabled(c) {
+		return
+	}
+
+	var request models.WebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Credential.ID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	clientDataJSON, err1 := decodeBase64URL(request.Credential.Response.ClientDataJSON)
+	authenticatorData, err2 := decodeBase64URL(request.Credential.Response.AuthenticatorData)
+	signature, err3 := decodeBase64URL(request.Credential.Response.Signature)
+	userHandle, err4 := decodeBase64URL(request.Credential.Response.UserHandle)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid credential", "fieldError": "credential"})
+		return
+	}
+
+	now := time.Now()
+	throttleKeys := loginThrottleKeys("passkey:"+request.Credential.ID, c.ClientIP())
+	if wait := loginRetryAfter(throttleKeys, now); wait > 0 {
+		audit.Failure(c, models.AuditPasskeyLogin, "", "throttled")
+		rejectLogin(c, wait)
+		return
+	}
+
+	challenge, ok := consumeWebAuthnChallenge(c, clientDataJSON, ceremonyLogin)
+	if !ok {
+		return
+	}
+
+	user, err := mongodb.FindUserByWebAuthnCredential(request.Credential.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not complete login"})
+		return
+	}
+	var stored *models.WebAuthnCredential
+	if user != nil {
+		for i := range user.WebAuthnCredentials {
+			if user.WebAuthnCredentials[i].ID == request.Credential.ID {
+				stored = &user.WebAuthnCredentials[i]
+			}
+		}
+	}
+	// The user handle, when sent, is the id the credential was created for
+	if stored == nil || (len(userHandle) > 0 && string(userHandle) != user.ID) {
+		recordLoginFailure(throttleKeys, now)
+		audit.Failure(c, models.AuditPasskeyLogin, "", "unknown_credential")
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid passkey"})
+		return
+	}
+
+	signCount, err := webauthn.Default.VerifyAssertion(clientDataJSON, authenticatorData, signature, challenge.value, stored.PublicKey, stored.SignCount)
+	if err != nil {
+		reason := "invalid_assertion"
+		if err == webauthn.ErrSignCount {
+			reason = "sign_count"
+		}
+		fmt.Println("Error verifying passkey login of", user.Username, err)
+		recordLoginFailure(throttleKeys, now)
+		audit.Failure(c, models.AuditPasskeyLogin, user.Username, reason)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid passkey"})
+		return
+	}
+
+	// The counter is only updated if unchanged, the same assertion cannot be used twice
+	updated, err := mongodb.UpdateWebAuthnSignCount(user.Username, stored.ID, stored.SignCount, signCount, now.UTC())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not complete login"})
+		return
+	}
+	if !updated {
+		audit.Failure(c, models.AuditPasskeyLogin, user.Username, "sign_count")
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid passkey"})
+		return
+	}
+	clearLoginFailures(throttleKeys)
+
+	if user.Disabled {
+		audit.Failure(c, models.AuditPasskeyLogin, user.Username, "disabled")
+		c.JSON(http.StatusForbidden, gin.H{"message": "Account disabled", "fieldError": "unauthorized"})
+		return
+	}
+
+	response, err := issueTokens(c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create token"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditPasskeyLogin, Actor: user.Username, Details: map[string]string{"credential": stored.ID}})
+
+	response["id"] = user.ID
+	response["user"] = user.Username
+	c.JSON(http.StatusOK, response)
+}
+
+// ListPasskeys returns the passkeys of the current user
+func ListPasskeys(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+
+	credentials := user.WebAuthnCredentials
+	if credentials == nil {
+		credentials = []models.WebAuthnCredential{}
+	}
+	c.JSON(http.StatusOK, gin.H{"credentials": credentials, "passkeyOnly": user.PasskeyOnly})
+}
+
+// DeletePasskey removes a passkey of the current user. The last passkey of a
+// passkey-only account cannot be removed, the user would be locked out.
+func DeletePasskey(c *gin.Context) {
+	var request models.PasskeyPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok || !reauthenticated(c, user, request.Password) {
+		return
+	}
+
+	credentialID := c.Param("id")
+	if user.PasskeyOnly && len(user.WebAuthnCredentials) <= 1 {
+		c.JSON(http.StatusConflict, gin.H{"message": "Allow password login before removing the last passkey"})
+		return
+	}
+
+	removed, err := mongodb.RemoveWebAuthnCredential(user.Username, credentialID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not remove passkey"})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Passkey not found"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditPasskeyRemove, Details: map[string]string{"credential": credentialID}})
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey removed"})
+}
+
+// SetPasskeyOnly makes a passkey the only way to log in, password logins are refused.
+// Like the passkey changes it requires the password or a recent login.
+func SetPasskeyOnly(c *gin.Context) {
+	var request models.PasskeyOnlyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+
+	user, ok := currentUser(c)
+	if !ok || !reauthenticated(c, user, request.Password) {
+		return
+	}
+	if request.Enabled && len(user.WebAuthnCredentials) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Register a passkey first"})
+		return
+	}
+
+	if err := mongodb.SetPasskeyOnly(user.Username, request.Enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update user"})
+		return
+	}
+
+	audit.Record(c, models.AuditEntry{Action: models.AuditPasskeyOnly, Details: map[string]string{"enabled": fmt.Sprint(request.Enabled)}})
+	c.JSON(http.StatusOK, gin.H{"message": "Login settings updated", "passkeyOnly": request.Enabled})
+}
+
+func webauthnEnabled(c *gin.Context) bool {
+	if webauthn.Default == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Passkeys are not configured"})
+		return false
+	}
+	return true
+}
+
+// newWebAuthnChallenge stores a challenge for the ceremony and returns it, writing the error response on failure
+func newWebAuthnChallenge(c *gin.Context, ceremony string, username string) (string, bool) {
+	challenge, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create challenge"})
+		return "", false
+	}
+
+	now := time.Now().UTC()
+	err = mongodb.SaveWebAuthnChallenge(models.WebAuthnChallenge{
+		ChallengeHash: utils.HashToken(challenge),
+		Ceremony:      ceremony,
+		Username:      username,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(WebAuthnChallengeTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create challenge"})
+		return "", false
+	}
+	return challenge, true
+}
+
+// pendingCeremony is a consumed challenge with its value, read from the client data
+type pendingCeremony struct {
+	models.WebAuthnChallenge
+	value string
+}
+
+// consumeWebAuthnChallenge finds the challenge signed in the client data and consumes it,
+// writing the error response when it is unknown or expired
+func consumeWebAuthnChallenge(c *gin.Context, clientDataJSON []byte, ceremony string) (*pendingCeremony, bool) {
+	value, err := webauthn.ClientDataChallenge(clientDataJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid credential", "fieldError": "credential"})
+		return nil, false
+	}
+
+	challenge, err := mongodb.ConsumeWebAuthnChallenge(utils.HashToken(value), ceremony)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not verify the passkey"})
+		return nil, false
+	}
+	if challenge == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid or expired challenge, please try again"})
+		return nil, false
+	}
+	return &pendingCeremony{WebAuthnChallenge: *challenge, value: value}, true
+}
+
+// decodeBase64URL decodes the binary fields of WebAuthn JSON, with or without padding
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+
+	"backend/internal/passwords"
+)
+
+// Config is the configuration of the backend, loaded once on startup by Load and passed
+// to each subsystem. Defaults are already applied, every value is valid.
+type Config struct {
+	Env         string // APP_ENV: local, dev or prod
+	EnvFile     string // file the environment was loaded from
+	Port        string
+	AllowOrigin string // frontend origin
+	AppName     string // issuer of the tokens
+
+	// Reverse proxies whose X-Forwarded-For is used for the client IP, addresses or CIDRs.
+	// Empty trusts none, the client IP is then the address of the connection.
+	TrustedProxies []string
+
+	CORS     CORS
+	Mongo    Mongo
+	Root     Root
+	Auth     Auth
+	OIDC     OIDC
+	WebAuthn WebAuthn
+	Mail     Mail
+	Storage  Storage
+	Shutdown Shutdown
+}
+
+// CORS lists the origins allowed to call the backend. Origins are exact or subdomain
+// patterns like https://*.example.com, for preview deployments.
+type CORS struct {
+	Origins       []string      // authentication and admin routes, with credentials
+	PublicOrigins []string      // tracking and CV routes, without credentials, may be *
+	MaxAge        time.Duration // preflight cache
+}
+
+// Shutdown configures the graceful shutdown on SIGINT and SIGTERM
+type Shutdown struct {
+	ReadinessDelay time.Duration // readiness fails this long before the server stops accepting requests
+	Timeout        time.Duration // deadline of the requests in flight
+}
+
+// Mongo is the database connection
+type Mongo struct {
+	URI      Secret // may hold credentials
+	Username string
+	Password Secret
+	Database string
+}
+
+// Root is the owner account created on the first start
+type Root struct {
+	Username string
+	Password Secret
+	Email    string
+}
+
+// Auth configures the tokens, the cookies and the password hashes
+type Auth struct {
+	JWTSecret    Secret
+	IPHashSecret Secret // JWTSecret when IP_HASH_SECRET is not set
+	AuditSecret  Secret // key of the audit hash chain, JWTSecret when AUDIT_SECRET is not set
+	KeyRotation  time.Duration
+	KeyGrace     time.Duration
+
+	CookieMode     bool   // AUTH_MODE=cookie
+	CookieDomain   string // empty for the host of the request
+	CookieSecure   bool
+	CookieSameSite string // strict, lax or none
+
+	PasswordResetURL string // frontend page receiving the reset token
+	TOTPIssuer       string // name shown by authenticator apps
+	Argon2           passwords.Params
+}
+
+// OIDC configures the login with an identity provider, disabled when Issuer is empty
+type OIDC struct {
+	Issuer         string
+	ClientID       string
+	ClientSecret   Secret
+	RedirectURL    string
+	Scopes         []string
+	AllowedEmails  []string          // lowercased
+	AllowedDomains []string          // lowercased, without @
+	RoleClaim      string            // dotted path of the claim holding the groups
+	RoleMap        map[string]string // group to role
+	DefaultRole    string
+	AllowOwner     bool // the role map or default role may give the owner role
+	LinkByEmail    bool // link existing users with the same email, owners excepted
+}
+
+// WebAuthn configures the passkey relying party, disabled when RPID is empty
+type WebAuthn struct {
+	RPID    string
+	RPName  string
+	Origins []string
+}
+
+// Mail selects the mail backend: log, file or smtp
+type Mail struct {
+	Backend      string
+	Dir          string
+	From         string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword Secret
+}
+
+// Storage selects the blob storage backend: local, gridfs or s3
+type Storage struct {
+	Backend      string
+	LocalDir     string
+	GridFSBucket string
+	S3           S3
+}
+
+// S3 is an S3 compatible bucket
+type S3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey Secret
+	PathStyle bool
+}
+
+// Secret is a setting that is never printed, fmt and JSON show it redacted
+type Secret string
+
+const redacted = "[redacted]"
+
+// Value returns the secret itself
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
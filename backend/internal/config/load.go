@@ -0,0 +1,458 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/internal/cors"
+	"backend/internal/models"
+	"backend/internal/passwords"
+	"backend/internal/utils"
+
+	"github.com/joho/godotenv"
+)
+
+// Defaults of JWT_KEY_ROTATION and JWT_KEY_GRACE
+const (
+	DefaultKeyRotation = 30 * 24 * time.Hour
+	DefaultKeyGrace    = 24 * time.Hour
+)
+
+// Defaults of SHUTDOWN_TIMEOUT and SHUTDOWN_READINESS_DELAY, the delay lets the load balancer
+// see the failing readiness probe. It is only applied in prod, where one runs.
+const (
+	DefaultShutdownTimeout        = 15 * time.Second
+	DefaultShutdownReadinessDelay = 5 * time.Second
+)
+
+// defaultName is used by the authenticator apps and passkeys when APP_NAME is not set
+const defaultName = "retro-dev-journey"
+
+// envFiles maps APP_ENV to the env file loaded for it
+var envFiles = map[string]string{"local": ".env.local", "dev": ".env.dev", "prod": ".env.prod"}
+
+// Flags are the command line settings, they win over the environment
+type Flags struct {
+	Env     string
+	EnvFile string
+	Port    string
+}
+
+// RegisterFlags adds -env, -env-file and -port to the flag set
+func RegisterFlags(set *flag.FlagSet) *Flags {
+	flags := &Flags{}
+	set.StringVar(&flags.Env, "env", "", "environment: local, dev or prod (default APP_ENV, then local)")
+	set.StringVar(&flags.EnvFile, "env-file", "", "env file to load (default .env.<env>)")
+	set.StringVar(&flags.Port, "port", "", "port to listen on (default PORT)")
+	return flags
+}
+
+// Load reads the configuration from the flags, the environment and the env file of APP_ENV,
+// the environment winning over the file. An optional .env fills the values still missing.
+// Every missing or invalid setting is reported in the returned error, not only the first.
+func Load(flags Flags) (*Config, error) {
+	l := &loader{}
+	cfg := &Config{}
+
+	cfg.Env = firstNonEmpty(flags.Env, os.Getenv("APP_ENV"), "local")
+	cfg.EnvFile = flags.EnvFile
+	if cfg.EnvFile == "" {
+		envFile, ok := envFiles[cfg.Env]
+		if !ok {
+			return nil, fmt.Errorf("APP_ENV must be local, dev or prod, got %q", cfg.Env)
+		}
+		cfg.EnvFile = envFile
+	}
+	if err := godotenv.Load(cfg.EnvFile); err != nil {
+		l.errorf("could not load env file %s: %v", cfg.EnvFile, err)
+	}
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(".env"); err != nil {
+			l.errorf("could not load env file .env: %v", err)
+		}
+	}
+
+	cfg.Port = flags.Port
+	if cfg.Port == "" {
+		cfg.Port = l.required("PORT")
+	}
+	if port, err := strconv.Atoi(cfg.Port); cfg.Port != "" && (err != nil || port < 1 || port > 65535) {
+		l.errorf("PORT must be a port number, got %q", cfg.Port)
+	}
+	cfg.AllowOrigin = strings.TrimRight(l.required("ALLOW_ORIGIN"), "/")
+	l.checkURL("ALLOW_ORIGIN", cfg.AllowOrigin)
+	cfg.AppName = l.string("APP_NAME", "")
+	cfg.TrustedProxies = l.proxies("TRUSTED_PROXIES")
+	cfg.CORS = loadCORS(l, cfg)
+
+	cfg.Mongo = Mongo{
+		URI:      Secret(l.required("MONGO_URI")),
+		Username: l.string("MONGO_USERNAME", ""),
+		Password: Secret(l.string("MONGO_PASSWORD", "")),
+		Database: l.required("DB_NAME"),
+	}
+
+	// The password and email are only needed to create the root user, on the first start
+	cfg.Root = Root{
+		Username: l.required("ROOT_USERNAME"),
+		Password: Secret(l.string("ROOT_PASSWORD", "")),
+		Email:    l.string("ROOT_EMAIL", ""),
+	}
+
+	cfg.Auth = loadAuth(l, cfg)
+	cfg.OIDC = loadOIDC(l, cfg)
+	cfg.WebAuthn = loadWebAuthn(l, cfg)
+	cfg.Mail = loadMail(l)
+	cfg.Storage = loadStorage(l)
+	cfg.Shutdown = loadShutdown(l, cfg)
+
+	if len(l.errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration:\n%v", errors.Join(l.errs...))
+	}
+	return cfg, nil
+}
+
+// Print writes the configuration one section per line, secrets redacted
+func (c *Config) Print(w io.Writer) {
+	fmt.Fprintf(w, "Env: %s (%s)\n", c.Env, c.EnvFile)
+	fmt.Fprintf(w, "Server: {Port:%s AllowOrigin:%s AppName:%s TrustedProxies:%v}\n", c.Port, c.AllowOrigin, c.AppName, c.TrustedProxies)
+	fmt.Fprintf(w, "Mongo: %+v\n", c.Mongo)
+	fmt.Fprintf(w, "Root: %+v\n", c.Root)
+	fmt.Fprintf(w, "Auth: %+v\n", c.Auth)
+	fmt.Fprintf(w, "OIDC: %+v\n", c.OIDC)
+	fmt.Fprintf(w, "WebAuthn: %+v\n", c.WebAuthn)
+	fmt.Fprintf(w, "Mail: %+v\n", c.Mail)
+	fmt.Fprintf(w, "Storage: %+v\n", c.Storage)
+	fmt.Fprintf(w, "Shutdown: %+v\n", c.Shutdown)
+}
+
+// DefaultCORSMaxAge is the default of CORS_MAX_AGE, browsers cap it to a few hours anyway
+const DefaultCORSMaxAge = 2 * time.Hour
+
+// loadCORS reads CORS_ORIGINS, defaulting to ALLOW_ORIGIN, and CORS_PUBLIC_ORIGINS, defaulting
+// to CORS_ORIGINS. Production only accepts https origins, local and dev also plain http ones.
+func loadCORS(l *loader, cfg *Config) CORS {
+	corsConfig := CORS{
+		Origins:       strings.Split(l.string("CORS_ORIGINS", cfg.AllowOrigin), ","),
+		PublicOrigins: strings.Split(l.string("CORS_PUBLIC_ORIGINS", l.string("CORS_ORIGINS", cfg.AllowOrigin)), ","),
+		MaxAge:        l.duration("CORS_MAX_AGE", DefaultCORSMaxAge),
+	}
+	corsConfig.Origins = l.origins("CORS_ORIGINS", corsConfig.Origins, cfg.Env, false)
+	corsConfig.PublicOrigins = l.origins("CORS_PUBLIC_ORIGINS", corsConfig.PublicOrigins, cfg.Env, true)
+	return corsConfig
+}
+
+func loadAuth(l *loader, cfg *Config) Auth {
+	auth := Auth{
+		JWTSecret:        Secret(l.required("JWT_SECRET")),
+		KeyRotation:      l.duration("JWT_KEY_ROTATION", DefaultKeyRotation),
+		KeyGrace:         l.duration("JWT_KEY_GRACE", DefaultKeyGrace),
+		CookieMode:       l.oneOf("AUTH_MODE", "header", "header", "cookie") == "cookie",
+		CookieDomain:     l.string("COOKIE_DOMAIN", ""),
+		CookieSecure:     l.bool("COOKIE_SECURE", true),
+		CookieSameSite:   l.oneOf("COOKIE_SAMESITE", "strict", "strict", "lax", "none"),
+		PasswordResetURL: l.url("PASSWORD_RESET_URL", cfg.AllowOrigin+"/reset-password"),
+		TOTPIssuer:       l.string("TOTP_ISSUER", firstNonEmpty(cfg.AppName, defaultName)),
+	}
+	if auth.JWTSecret != "" {
+		if err := utils.CheckJWTSecret(auth.JWTSecret.Value()); err != nil {
+			l.errorf("%v", err)
+		}
+	}
+	auth.IPHashSecret = Secret(l.string("IP_HASH_SECRET", auth.JWTSecret.Value()))
+	auth.AuditSecret = Secret(l.string("AUDIT_SECRET", auth.JWTSecret.Value()))
+	if auth.CookieSameSite == "none" && !auth.CookieSecure {
+		l.errorf("COOKIE_SAMESITE=none requires COOKIE_SECURE")
+	}
+
+	auth.Argon2 = passwords.DefaultParams
+	auth.Argon2.Memory = uint32(l.uint("PASSWORD_ARGON2_MEMORY", uint64(auth.Argon2.Memory), 8*1024, 4*1024*1024))
+	auth.Argon2.Time = uint32(l.uint("PASSWORD_ARGON2_TIME", uint64(auth.Argon2.Time), 1, 100))
+	auth.Argon2.Threads = uint8(l.uint("PASSWORD_ARGON2_THREADS", uint64(auth.Argon2.Threads), 1, 255))
+
+	return auth
+}
+
+func loadOIDC(l *loader, cfg *Config) OIDC {
+	oidc := OIDC{Issuer: l.string("OIDC_ISSUER", "")}
+	if oidc.Issuer == "" {
+		return oidc
+	}
+
+	oidc.ClientID = l.required("OIDC_CLIENT_ID")
+	oidc.ClientSecret = Secret(l.string("OIDC_CLIENT_SECRET", ""))
+	oidc.RedirectURL = l.url("OIDC_REDIRECT_URL", cfg.AllowOrigin+"/oidc/callback")
+	oidc.Scopes = strings.Fields(l.string("OIDC_SCOPES", "openid email profile"))
+	oidc.AllowedEmails = list(l.string("OIDC_ALLOWED_EMAILS", ""))
+	oidc.AllowedDomains = []string{}
+	for _, domain := range list(l.string("OIDC_ALLOWED_DOMAINS", "")) {
+		oidc.AllowedDomains = append(oidc.AllowedDomains, strings.TrimPrefix(domain, "@"))
+	}
+	oidc.RoleClaim = l.string("OIDC_ROLE_CLAIM", "groups")
+	oidc.AllowOwner = l.bool("OIDC_ALLOW_OWNER", false)
+	oidc.LinkByEmail = l.bool("OIDC_LINK_BY_EMAIL", false)
+	oidc.DefaultRole = strings.ToLower(l.string("OIDC_DEFAULT_ROLE", models.RoleViewer))
+	if !models.IsValidRole(oidc.DefaultRole) {
+		l.errorf("OIDC_DEFAULT_ROLE has an unknown role %q", oidc.DefaultRole)
+	} else if oidc.DefaultRole == models.RoleOwner && !oidc.AllowOwner {
+		l.errorf("OIDC_DEFAULT_ROLE=owner requires OIDC_ALLOW_OWNER=true")
+	}
+
+	oidc.RoleMap = map[string]string{}
+	for _, pair := range strings.Split(l.string("OIDC_ROLE_MAP", ""), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		value, role, found := strings.Cut(pair, "=")
+		role = strings.ToLower(strings.TrimSpace(role))
+		if !found || !models.IsValidRole(role) {
+			l.errorf("OIDC_ROLE_MAP has an invalid pair %q, expected group=role", pair)
+			continue
+		}
+		if role == models.RoleOwner && !oidc.AllowOwner {
+			l.errorf("OIDC_ROLE_MAP maps %q to owner, which requires OIDC_ALLOW_OWNER=true", strings.TrimSpace(value))
+			continue
+		}
+		oidc.RoleMap[strings.TrimSpace(value)] = role
+	}
+
+	l.checkURL("OIDC_ISSUER", oidc.Issuer)
+	return oidc
+}
+
+func loadWebAuthn(l *loader, cfg *Config) WebAuthn {
+	webAuthn := WebAuthn{Origins: []string{}}
+	for _, origin := range strings.Split(l.string("WEBAUTHN_ORIGINS", ""), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			l.checkURL("WEBAUTHN_ORIGINS", origin)
+			webAuthn.Origins = append(webAuthn.Origins, origin)
+		}
+	}
+	if len(webAuthn.Origins) == 0 && cfg.AllowOrigin != "" {
+		webAuthn.Origins = []string{cfg.AllowOrigin}
+	}
+
+	webAuthn.RPID = l.string("WEBAUTHN_RP_ID", "")
+	if webAuthn.RPID == "" && len(webAuthn.Origins) > 0 {
+		if parsed, err := url.Parse(webAuthn.Origins[0]); err == nil {
+			webAuthn.RPID = parsed.Hostname()
+		}
+	}
+	webAuthn.RPName = l.string("WEBAUTHN_RP_NAME", firstNonEmpty(cfg.AppName, defaultName))
+	return webAuthn
+}
+
+func loadMail(l *loader) Mail {
+	mail := Mail{
+		Backend:      l.oneOf("MAIL_BACKEND", "log", "log", "file", "smtp"),
+		Dir:          l.string("MAIL_DIR", ""),
+		From:         l.string("MAIL_FROM", ""),
+		SMTPHost:     l.string("SMTP_HOST", ""),
+		SMTPPort:     l.string("SMTP_PORT", "587"),
+		SMTPUsername: l.string("SMTP_USERNAME", ""),
+		SMTPPassword: Secret(l.string("SMTP_PASSWORD", "")),
+	}
+	if mail.Backend == "smtp" && (mail.SMTPHost == "" || mail.From == "") {
+		l.errorf("SMTP_HOST and MAIL_FROM are required with MAIL_BACKEND=smtp")
+	}
+	return mail
+}
+
+func loadStorage(l *loader) Storage {
+	storage := Storage{
+		Backend:      l.oneOf("STORAGE_BACKEND", "local", "local", "gridfs", "s3"),
+		LocalDir:     l.string("STORAGE_LOCAL_DIR", ""),
+		GridFSBucket: l.string("STORAGE_GRIDFS_BUCKET", ""),
+	}
+	if storage.Backend != "s3" {
+		return storage
+	}
+
+	storage.S3 = S3{
+		Endpoint:  l.required("S3_ENDPOINT"),
+		Region:    l.string("S3_REGION", "us-east-1"),
+		Bucket:    l.required("S3_BUCKET"),
+		AccessKey: l.required("S3_ACCESS_KEY"),
+		SecretKey: Secret(l.required("S3_SECRET_KEY")),
+		PathStyle: l.bool("S3_PATH_STYLE", true),
+	}
+	l.checkURL("S3_ENDPOINT", storage.S3.Endpoint)
+	return storage
+}
+
+func loadShutdown(l *loader, cfg *Config) Shutdown {
+	readinessDelay := time.Duration(0)
+	if cfg.Env == "prod" {
+		readinessDelay = DefaultShutdownReadinessDelay
+	}
+	shutdown := Shutdown{Timeout: l.duration("SHUTDOWN_TIMEOUT", DefaultShutdownTimeout)}
+	if l.string("SHUTDOWN_READINESS_DELAY", "") == "0" {
+		return shutdown
+	}
+	shutdown.ReadinessDelay = l.duration("SHUTDOWN_READINESS_DELAY", readinessDelay)
+	return shutdown
+}
+
+// loader reads the environment, collecting the errors instead of stopping at the first one
+type loader struct {
+	errs []error
+}
+
+func (l *loader) errorf(format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Errorf(format, args...))
+}
+
+func (l *loader) string(name, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (l *loader) required(name string) string {
+	value := l.string(name, "")
+	if value == "" {
+		l.errorf("%s is not set", name)
+	}
+	return value
+}
+
+// oneOf reads a lowercased value which must be one of values
+func (l *loader) oneOf(name, fallback string, values ...string) string {
+	value := strings.ToLower(l.string(name, fallback))
+	for _, allowed := range values {
+		if value == allowed {
+			return value
+		}
+	}
+	l.errorf("%s must be one of %s, got %q", name, strings.Join(values, ", "), value)
+	return fallback
+}
+
+func (l *loader) bool(name string, fallback bool) bool {
+	value := l.string(name, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		l.errorf("%s must be true or false, got %q", name, value)
+		return fallback
+	}
+	return parsed
+}
+
+func (l *loader) duration(name string, fallback time.Duration) time.Duration {
+	value := l.string(name, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		l.errorf("%s must be a positive duration like 24h, got %q", name, value)
+		return fallback
+	}
+	return parsed
+}
+
+func (l *loader) uint(name string, fallback, min, max uint64) uint64 {
+	value := l.string(name, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || parsed < min || parsed > max {
+		l.errorf("%s must be between %d and %d, got %q", name, min, max, value)
+		return fallback
+	}
+	return parsed
+}
+
+// url reads an http or https URL, the fallback derived from other settings is not checked again
+func (l *loader) url(name, fallback string) string {
+	value := l.string(name, "")
+	if value == "" {
+		return fallback
+	}
+	l.checkURL(name, value)
+	return value
+}
+
+// origins cleans and checks a list of CORS origins, * is only accepted without credentials
+func (l *loader) origins(name string, values []string, env string, allowAny bool) []string {
+	origins := []string{}
+	for _, origin := range values {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		if origin == "" {
+			continue
+		}
+		if err := cors.ValidateOrigin(origin); err != nil {
+			l.errorf("%s: %v", name, err)
+			continue
+		}
+		if origin == "*" && !allowAny {
+			l.errorf("%s cannot be *, its routes allow credentials", name)
+			continue
+		}
+		if env == "prod" && origin != "*" && !strings.HasPrefix(origin, "https://") {
+			l.errorf("%s must only have https origins in prod, got %q", name, origin)
+			continue
+		}
+		origins = append(origins, origin)
+	}
+	return origins
+}
+
+// proxies reads a comma separated list of IP addresses or CIDRs
+func (l *loader) proxies(name string) []string {
+	proxies := []string{}
+	for _, proxy := range list(l.string(name, "")) {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				l.errorf("%s must only have IP addresses or CIDRs, got %q", name, proxy)
+				continue
+			}
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies
+}
+
+// checkURL reports the value if it is set but not an http or https URL
+func (l *loader) checkURL(name, value string) {
+	if value == "" {
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		l.errorf("%s must be an http or https URL, got %q", name, value)
+	}
+}
+
+// list splits a comma separated setting, lowercased and without empty items
+func list(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
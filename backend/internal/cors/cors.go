@@ -0,0 +1,143 @@
+package cors
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Policy is the CORS policy of a group of routes. Origins are exact, like https://retrojourney.dev,
+// patterns matching the subdomains, like https://*.example.com, or * for any origin.
+type Policy struct {
+	Origins          []string
+	AllowCredentials bool
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	MaxAge           time.Duration // how long browsers may cache the preflight response
+}
+
+// Headers the frontend sends and reads: authentication, CSRF, conditional and range requests
+var (
+	DefaultAllowHeaders  = []string{"Content-Type", "Authorization", "X-API-Key", "X-CSRF-Token", "Range", "If-None-Match", "If-Modified-Since"}
+	DefaultExposeHeaders = []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"}
+)
+
+// ValidateOrigin returns an error if the origin of the configuration is neither *, an origin
+// nor a subdomain pattern. Origins have no path, patterns a single * as first label.
+func ValidateOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		(parsed.Path != "" && parsed.Path != "/") || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+	}
+
+	host := parsed.Host
+	if strings.Contains(host, "*") {
+		rest, found := strings.CutPrefix(host, "*.")
+		if !found || strings.Contains(rest, "*") || !strings.Contains(rest, ".") {
+			return fmt.Errorf("invalid origin pattern %q, expected scheme://*.domain.tld", origin)
+		}
+	}
+	return nil
+}
+
+// AllowsOrigin reports whether the origin sent by the browser matches the policy.
+// A pattern matches the subdomains at any depth, not the domain itself.
+func (p *Policy) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(origin)
+
+	for _, allowed := range p.Origins {
+		allowed = strings.ToLower(strings.TrimRight(allowed, "/"))
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+
+		scheme, pattern, found := strings.Cut(allowed, "://*.")
+		if !found {
+			continue
+		}
+		prefix := scheme + "://"
+		if !strings.HasPrefix(origin, prefix) {
+			continue
+		}
+		host := strings.TrimPrefix(origin, prefix)
+		if sub, ok := strings.CutSuffix(host, "."+pattern); ok && sub != "" && !strings.ContainsAny(sub, "/:@") {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware adds the CORS headers to the responses of allowed origins, it must run before
+// the authentication so the errors can be read by the frontend
+func (p *Policy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Origin")
+
+		origin := c.GetHeader("Origin")
+		if p.AllowsOrigin(origin) {
+			p.setAllowOrigin(c, origin)
+			if len(p.ExposeHeaders) > 0 {
+				c.Header("Access-Control-Expose-Headers", strings.Join(p.ExposeHeaders, ", "))
+			}
+		}
+		c.Next()
+	}
+}
+
+// Preflight answers the OPTIONS requests of a path. policies maps each method of the path
+// to its policy, the one of the requested method decides.
+func Preflight(policies map[string]*Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+
+		origin := c.GetHeader("Origin")
+		policy := policies[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))]
+		if policy == nil || !policy.AllowsOrigin(origin) {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		methods := []string{}
+		for method, methodPolicy := range policies {
+			if methodPolicy == policy {
+				methods = append(methods, method)
+			}
+		}
+		sort.Strings(methods)
+
+		policy.setAllowOrigin(c, origin)
+		c.Header("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if len(policy.AllowHeaders) > 0 {
+			c.Header("Access-Control-Allow-Headers", strings.Join(policy.AllowHeaders, ", "))
+		}
+		if policy.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// setAllowOrigin echoes the origin, the configuration refuses * in the policies with credentials
+func (p *Policy) setAllowOrigin(c *gin.Context, origin string) {
+	c.Header("Access-Control-Allow-Origin", origin)
+	if p.AllowCredentials {
+		c.Header("Access-Control-Allow-Credentials", "true")
+	}
+}
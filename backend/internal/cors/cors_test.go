@@ -0,0 +1,172 @@
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		ok     bool
+	}{
+		{"*", true},
+		{"https://retrojourney.dev", true},
+		{"https://retrojourney.dev/", true},
+		{"http://localhost:5173", true},
+		{"https://*.example.com", true},
+		{"retrojourney.dev", false},
+		{"ftp://retrojourney.dev", false},
+		{"https://retrojourney.dev/app", false},
+		{"https://retrojourney.dev?x=1", false},
+		{"https://*", false},
+		{"https://*.com", false},
+		{"https://a.*.example.com", false},
+		{"https://*.*.example.com", false},
+	}
+	for _, test := range tests {
+		if err := ValidateOrigin(test.origin); (err == nil) != test.ok {
+			t.Errorf("ValidateOrigin(%q) = %v, want ok %v", test.origin, err, test.ok)
+		}
+	}
+}
+
+func TestAllowsOrigin(t *testing.T) {
+	policy := &Policy{Origins: []string{"https://retrojourney.dev/", "https://*.example.com"}}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://retrojourney.dev", true},
+		{"https://RetroJourney.dev", true},
+		{"http://retrojourney.dev", false},
+		{"https://retrojourney.dev.evil.com", false},
+		{"https://app.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"http://app.example.com", false},
+		{"https://evilexample.com", false},
+		{"https://app.example.com:8443", false},
+		{"https://user@app.example.com", false},
+		{"", false},
+		{"null", false},
+	}
+	for _, test := range tests {
+		if got := policy.AllowsOrigin(test.origin); got != test.want {
+			t.Errorf("AllowsOrigin(%q) = %v, want %v", test.origin, got, test.want)
+		}
+	}
+
+	if !(&Policy{Origins: []string{"*"}}).AllowsOrigin("https://anywhere.dev") {
+		t.Error("* does not allow every origin")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	policy := &Policy{Origins: []string{"https://retrojourney.dev"}, AllowCredentials: true, ExposeHeaders: []string{"ETag"}}
+
+	tests := []struct {
+		origin      string
+		allowOrigin string
+	}{
+		{"https://retrojourney.dev", "https://retrojourney.dev"},
+		{"https://evil.com", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		r := gin.New()
+		r.Use(policy.Middleware())
+		r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if test.origin != "" {
+			req.Header.Set("Origin", test.origin)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		header := w.Header()
+		if w.Code != http.StatusOK || header.Get("Vary") != "Origin" {
+			t.Errorf("origin %q: status %d, Vary %q", test.origin, w.Code, header.Get("Vary"))
+		}
+		if got := header.Get("Access-Control-Allow-Origin"); got != test.allowOrigin {
+			t.Errorf("origin %q: Access-Control-Allow-Origin = %q, want %q", test.origin, got, test.allowOrigin)
+		}
+		allowed := test.allowOrigin != ""
+		if (header.Get("Access-Control-Allow-Credentials") == "true") != allowed || (header.Get("Access-Control-Expose-Headers") == "ETag") != allowed {
+			t.Errorf("origin %q: credentials and exposed headers sent = %v", test.origin, !allowed)
+		}
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	frontend := &Policy{Origins: []string{"https://retrojourney.dev"}, AllowCredentials: true, AllowHeaders: []string{"Authorization"}, MaxAge: 10 * time.Minute}
+	public := &Policy{Origins: []string{"*"}}
+	handler := Preflight(map[string]*Policy{http.MethodGet: public, http.MethodHead: public, http.MethodPost: frontend, http.MethodPut: frontend})
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		status  int
+		methods string
+	}{
+		{"frontend", "https://retrojourney.dev", "POST", http.StatusNoContent, "POST, PUT"},
+		{"lower case method", "https://retrojourney.dev", "put", http.StatusNoContent, "POST, PUT"},
+		{"public", "https://anywhere.dev", "GET", http.StatusNoContent, "GET, HEAD"},
+		{"other origin on a frontend method", "https://anywhere.dev", "POST", http.StatusForbidden, ""},
+		{"method without a route", "https://retrojourney.dev", "DELETE", http.StatusForbidden, ""},
+		{"no method", "https://retrojourney.dev", "", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := gin.New()
+			r.OPTIONS("/", handler)
+
+			req := httptest.NewRequest(http.MethodOptions, "/", nil)
+			req.Header.Set("Origin", test.origin)
+			if test.method != "" {
+				req.Header.Set("Access-Control-Request-Method", test.method)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			header := w.Header()
+			if w.Code != test.status {
+				t.Fatalf("status = %d, want %d", w.Code, test.status)
+			}
+			if len(header.Values("Vary")) != 3 {
+				t.Errorf("Vary = %v", header.Values("Vary"))
+			}
+			if test.status != http.StatusNoContent {
+				if header.Get("Access-Control-Allow-Origin") != "" {
+					t.Error("refused preflight allows the origin")
+				}
+				return
+			}
+			if header.Get("Access-Control-Allow-Origin") != test.origin || header.Get("Access-Control-Allow-Methods") != test.methods {
+				t.Errorf("allowed origin %q, methods %q", header.Get("Access-Control-Allow-Origin"), header.Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+
+	// The frontend policy sends its credentials, headers and cache duration
+	r := gin.New()
+	r.OPTIONS("/", handler)
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://retrojourney.dev")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	header := w.Header()
+	if header.Get("Access-Control-Allow-Credentials") != "true" || header.Get("Access-Control-Allow-Headers") != "Authorization" || header.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("preflight headers = %v", header)
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/models"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pagination of the audit log
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// Get the audit log, newest first
+// GET /admin/audit?action=auth.login&actor=root&outcome=failure&start_date=2025-01-01&end_date=2025-01-31&page=1&limit=50
+func GetAuditLog(c *gin.Context) {
+	filter := models.AuditFilter{
+		Action:  c.Query("action"),
+		Actor:   c.Query("actor"),
+		Outcome: c.Query("outcome"),
+		Page:    1,
+		Limit:   defaultAuditLimit,
+	}
+
+	if value := c.Query("page"); value != "" {
+		page, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid page", "fieldError": "page"})
+			return
+		}
+		filter.Page = page
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit, use 1 to 200", "fieldError": "limit"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	// Dates are optional here, the end date is included
+	if value := c.Query("start_date"); value != "" {
+		startDate, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid date format. Use YYYY-MM-DD", "fieldError": "start_date"})
+			return
+		}
+		filter.StartDate = &startDate
+	}
+	if value := c.Query("end_date"); value != "" {
+		endDate, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid date format. Use YYYY-MM-DD", "fieldError": "end_date"})
+			return
+		}
+		endDate = endDate.AddDate(0, 0, 1)
+		filter.EndDate = &endDate
+	}
+
+	entries, total, err := mongodb.FindAuditEntries(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  entries,
+		"page":  filter.Page,
+		"limit": filter.Limit,
+		"total": total,
+	})
+}
+
+// Check the hash chain of the audit log
+// GET /admin/audit/verify
+func VerifyAuditLog(c *gin.Context) {
+	report, err := audit.Verify()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to verify audit log"})
+		return
+	}
+
+	response := gin.H{"valid": report.BrokenAt == 0, "checked": report.Checked}
+	if report.BrokenAt != 0 {
+		response["brokenAt"] = report.BrokenAt
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/queue"
+	"backend/internal/utils"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DownloadCooldown mirrors downloadCVCooldown in frontend/src/Pages/Sandbox/config.ts,
+// repeated downloads of an IP within it are served but recorded once
+const DownloadCooldown = 60 * time.Second
+
+// DownloadQueueSize bounds the download events waiting to be saved
+const DownloadQueueSize = 1024
+
+var (
+	downloadsMu     sync.Mutex
+	downloadsWriter *queue.Queue[models.DownloadEvent]
+)
+
+// downloadCooldowns remembers the last recorded download per IP hash
+type downloadCooldowns struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+var cooldowns = &downloadCooldowns{last: map[string]time.Time{}}
+
+// shouldRecord reports whether the download of the IP is recorded and marks it if so
+func (d *downloadCooldowns) shouldRecord(ipHash string, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if last, ok := d.last[ipHash]; ok && now.Sub(last) < DownloadCooldown {
+		return false
+	}
+
+	// Drop expired entries once in a while so the map does not grow forever
+	if len(d.last) > 1000 {
+		for key, last := range d.last {
+			if now.Sub(last) >= DownloadCooldown {
+				delete(d.last, key)
+			}
+		}
+	}
+
+	d.last[ipHash] = now
+	return true
+}
+
+// isFullDownload reports whether the request fetches the whole file. Range requests,
+// including the bytes=0- probes of PDF viewers, and HEAD requests are not counted.
+func isFullDownload(r *http.Request) bool {
+	return r.Method == http.MethodGet && r.Header.Get("Range") == ""
+}
+
+// downloadPage returns the page the download comes from: the page query param,
+// the path of the referrer or "direct" for direct link hits
+func downloadPage(c *gin.Context) string {
+	if page := c.Query("page"); page != "" {
+		return truncate(page, 100)
+	}
+	if referrer, err := url.Parse(c.Request.Referer()); err == nil && referrer.Path != "" {
+		return truncate(referrer.Path, 100)
+	}
+	return "direct"
+}
+
+// StartDownloadRecorder starts saving the download events in background, it returns a
+// function stopping it once the queued events are saved. Events recorded while no
+// recorder runs are saved by the request itself.
+func StartDownloadRecorder() (stop func()) {
+	downloadsMu.Lock()
+	defer downloadsMu.Unlock()
+
+	q := queue.Start("downloads", DownloadQueueSize, mongodb.SaveDownloadEvent)
+	downloadsWriter = q
+
+	return func() {
+		q.Stop()
+		downloadsMu.Lock()
+		if downloadsWriter == q {
+			downloadsWriter = nil
+		}
+		downloadsMu.Unlock()
+	}
+}
+
+// CheckDownloadQueue reports a saturated download queue to the readiness probe
+func CheckDownloadQueue(ctx context.Context) error {
+	downloadsMu.Lock()
+	q := downloadsWriter
+	downloadsMu.Unlock()
+
+	if q != nil {
+		return q.Check(ctx)
+	}
+	return nil
+}
+
+func recordDownload(c *gin.Context, ipHash string, etag string, now time.Time) {
+	event := models.DownloadEvent{
+		Date:      now.UTC().Format(time.RFC3339),
+		Page:      downloadPage(c),
+		UUID:      truncate(c.Query("uuid"), 64),
+		IPHash:    ipHash,
+		UserAgent: truncate(c.Request.UserAgent(), 512),
+		Referrer:  truncate(c.Request.Referer(), 512),
+		ETag:      etag,
+	}
+
+	downloadsMu.Lock()
+	q := downloadsWriter
+	downloadsMu.Unlock()
+
+	if q != nil {
+		q.Push(event)
+		return
+	}
+	mongodb.SaveDownloadEvent(event)
+}
+
+func clientIPHash(c *gin.Context) string {
+	return utils.HashIP(c.ClientIP())
+}
+
+func truncate(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsFullDownload(t *testing.T) {
+	tests := []struct {
+		method string
+		rangeH string
+		want   bool
+	}{
+		{http.MethodGet, "", true},
+		{http.MethodGet, "bytes=0-", false},
+		{http.MethodGet, "bytes=0-1023", false},
+		{http.MethodGet, "bytes=1024-", false},
+		{http.MethodHead, "", false},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, "/cv/download", nil)
+		if test.rangeH != "" {
+			req.Header.Set("Range", test.rangeH)
+		}
+		if got := isFullDownload(req); got != test.want {
+			t.Errorf("isFullDownload(%s, Range %q) = %v, want %v", test.method, test.rangeH, got, test.want)
+		}
+	}
+}
+
+func TestDownloadCooldown(t *testing.T) {
+	cooldowns := &downloadCooldowns{last: map[string]time.Time{}}
+	now := time.Now()
+
+	steps := []struct {
+		ipHash string
+		after  time.Duration
+		want   bool
+	}{
+		{"ip-a", 0, true},
+		{"ip-a", 10 * time.Second, false},
+		{"ip-b", 10 * time.Second, true},
+		{"ip-a", DownloadCooldown - time.Second, false},
+		{"ip-a", DownloadCooldown, true},
+	}
+	for i, step := range steps {
+		if got := cooldowns.shouldRecord(step.ipHash, now.Add(step.after)); got != step.want {
+			t.Errorf("step %d: shouldRecord(%s) = %v, want %v", i, step.ipHash, got, step.want)
+		}
+	}
+}
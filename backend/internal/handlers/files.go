@@ -1,35 +1,122 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/internal/audit"
+	"backend/internal/auth"
+	"backend/internal/models"
+	"backend/internal/pdf"
+	"backend/internal/storage"
+	"backend/mongodb"
 
 	"github.com/gin-gonic/gin"
 )
 
 const (
-	CVDirectory = "./uploads"
 	CVFilename  = "pezzati_mauro_developer.pdf"
 	MaxFileSize = 5 * 1024 * 1024
 )
 
+// cvContent is the last CV version read from the blob store, kept in memory with its validators
+type cvContent struct {
+	size    int64
+	modTime time.Time
+	etag    string
+	data    []byte
+}
+
+var (
+	cvCacheMutex sync.Mutex
+	cvCache      *cvContent
+)
+
+// loadCV returns the current CV content. The blob is read again only when its size or
+// modification time changed, so the ETag follows every UploadCV automatically.
+func loadCV(ctx context.Context) (*cvContent, error) {
+	info, err := storage.Store.Stat(ctx, CVFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	cvCacheMutex.Lock()
+	defer cvCacheMutex.Unlock()
+
+	if cvCache != nil && cvCache.size == info.Size && cvCache.modTime.Equal(info.ModTime) {
+		return cvCache, nil
+	}
+
+	reader, info, err := storage.Store.Get(ctx, CVFilename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	cvCache = &cvContent{
+		size:    info.Size,
+		modTime: info.ModTime,
+		etag:    fmt.Sprintf("\"%s\"", hex.EncodeToString(hash[:])),
+		data:    data,
+	}
+
+	return cvCache, nil
+}
+
+func resetCVCache() {
+	cvCacheMutex.Lock()
+	cvCache = nil
+	cvCacheMutex.Unlock()
+}
+
+// DownloadCV serves the CV with strong ETag and Last-Modified validators.
+// http.ServeContent answers If-None-Match / If-Modified-Since with 304 and handles Range requests.
+// Full downloads are recorded server-side, once per IP every DownloadCooldown.
 func DownloadCV(c *gin.Context) {
-	cvPath := filepath.Join(CVDirectory, CVFilename)
+	now := time.Now()
 
-	if _, err := os.Stat(cvPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"message": "CV file not found"})
+	cv, err := loadCV(c.Request.Context())
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "CV file not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to read CV file"})
 		return
 	}
 
 	c.Header("Content-Type", "application/pdf")
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", CVFilename))
-	c.Header("Content-Transfer-Encoding", "binary")
-	c.Header("Cache-Control", "no-cache")
-
-	c.File(cvPath)
+	c.Header("ETag", cv.etag)
+	// Clients may keep a copy but must revalidate it with the ETag before use
+	c.Header("Cache-Control", "public, no-cache")
+
+	http.ServeContent(c.Writer, c.Request, CVFilename, cv.modTime, bytes.NewReader(cv.data))
+
+	// Revalidations answered with 304 are not downloads
+	if isFullDownload(c.Request) && c.Writer.Status() == http.StatusOK {
+		ipHash := clientIPHash(c)
+		if cooldowns.shouldRecord(ipHash, now) {
+			recordDownload(c, ipHash, cv.etag, now)
+		}
+	}
 }
 
 func UploadCV(c *gin.Context) {
@@ -49,11 +136,6 @@ func UploadCV(c *gin.Context) {
 		return
 	}
 
-	if err := os.MkdirAll(CVDirectory, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create upload directory"})
-		return
-	}
-
 	src, err := file.Open()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to open uploaded file"})
@@ -61,47 +143,92 @@ func UploadCV(c *gin.Context) {
 	}
 	defer src.Close()
 
-	// Validate MIME type by reading file header
-	buffer := make([]byte, 512)
-	_, err = src.Read(buffer)
+	// The whole file is needed to validate the PDF structure
+	data, err := io.ReadAll(io.LimitReader(src, MaxFileSize+1))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to read file"})
 		return
 	}
-
-	src.Close()
-	src, err = file.Open()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to reopen file"})
+	if len(data) > MaxFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "File size exceeds 5MB limit"})
 		return
 	}
-	defer src.Close()
 
-	contentType := http.DetectContentType(buffer)
+	// Validate MIME type from the file header
+	contentType := http.DetectContentType(data)
 	if contentType != "application/pdf" {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "File is not a valid PDF"})
+		c.JSON(http.StatusBadRequest, gin.H{"message": "File is not a valid PDF", "rule": pdf.RuleStructure})
 		return
 	}
 
-	cvPath := filepath.Join(CVDirectory, CVFilename)
-
-	dst, err := os.Create(cvPath)
+	info, err := pdf.Validate(data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create destination file"})
+		var validationErr *pdf.ValidationError
+		if errors.As(err, &validationErr) {
+			audit.Record(c, models.AuditEntry{Action: models.AuditCVUpload, Outcome: models.AuditFailure, Target: CVFilename, Reason: validationErr.Rule})
+			c.JSON(http.StatusBadRequest, gin.H{"message": validationErr.Message, "rule": validationErr.Rule})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to validate file"})
 		return
 	}
-	defer dst.Close()
 
-	_, err = io.Copy(dst, src)
+	err = storage.Store.Put(c.Request.Context(), CVFilename, bytes.NewReader(data), int64(len(data)), contentType)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save file"})
 		return
 	}
+	resetCVCache()
+
+	hash := sha256.Sum256(data)
+	hashHex := hex.EncodeToString(hash[:])
+
+	previous, err := mongodb.GetLatestCVUpload(CVFilename)
+	if err != nil {
+		fmt.Println("Error getting previous CV upload", err)
+	}
+
+	previews, err := storePreviews(c.Request.Context(), hashHex, data)
+	if err != nil {
+		fmt.Println("Error generating CV previews", err)
+		previews = []models.CVPreview{}
+	}
+
+	upload := models.CVUpload{
+		Filename:     CVFilename,
+		Size:         int64(len(data)),
+		SHA256:       hashHex,
+		PageCount:    info.PageCount,
+		PDFVersion:   info.Version,
+		Title:        info.Title,
+		Author:       info.Author,
+		CreationDate: info.CreationDate,
+		UploadedBy:   auth.CurrentUsername(c),
+		UploadedAt:   time.Now().UTC(),
+		Previews:     previews,
+	}
+
+	upload.ID, err = mongodb.SaveCVUpload(upload)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save file metadata"})
+		return
+	}
+
+	if previous != nil {
+		deletePreviews(c.Request.Context(), previous, previews)
+	}
+
+	audit.Record(c, models.AuditEntry{
+		Action:  models.AuditCVUpload,
+		Target:  CVFilename,
+		Details: map[string]string{"sha256": hashHex, "size": strconv.FormatInt(upload.Size, 10), "upload": upload.ID},
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":  "CV uploaded successfully",
 		"filename": CVFilename,
-		"size":     file.Size,
+		"size":     upload.Size,
+		"metadata": upload,
 	})
 }
 
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"backend/internal/storage"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadinessTimeout bounds all the checks of a readiness probe
+const ReadinessTimeout = 2 * time.Second
+
+// Build information, set at build time with
+// -ldflags "-X backend/internal/handlers.GitCommit=... -X backend/internal/handlers.BuildTime=...".
+// The VCS information embedded by go build is used when they are empty.
+var (
+	GitCommit string
+	BuildTime string
+)
+
+// ReadinessCheck returns an error when the backend cannot serve requests
+type ReadinessCheck func(ctx context.Context) error
+
+var (
+	shuttingDown    atomic.Bool
+	readinessMu     sync.Mutex
+	readinessChecks = []namedCheck{
+		{"mongo", mongodb.Ping},
+		{"storage", func(ctx context.Context) error { return storage.CheckWritable() }},
+	}
+)
+
+type namedCheck struct {
+	name  string
+	check ReadinessCheck
+}
+
+// AddReadinessCheck adds a check to the readiness probe, main adds the saturation checks of
+// the background queues
+func AddReadinessCheck(name string, check ReadinessCheck) {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+	readinessChecks = append(readinessChecks, namedCheck{name, check})
+}
+
+// MarkShuttingDown makes the readiness probe fail, so the load balancer stops sending requests
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// Healthz answers while the process is alive, it does not check the dependencies
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz runs the readiness checks, it fails during the graceful shutdown
+func Readyz(c *gin.Context) {
+	if shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+		return
+	}
+
+	readinessMu.Lock()
+	checks := append([]namedCheck{}, readinessChecks...)
+	readinessMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), ReadinessTimeout)
+	defer cancel()
+
+	// Checks run concurrently so a slow one does not hide the others
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = check.check(ctx)
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	report := gin.H{}
+	for i, check := range checks {
+		if results[i] != nil {
+			status = http.StatusServiceUnavailable
+			report[check.name] = results[i].Error()
+		} else {
+			report[check.name] = "ok"
+		}
+	}
+
+	if status == http.StatusOK {
+		c.JSON(status, gin.H{"status": "ready", "checks": report})
+		return
+	}
+	c.JSON(status, gin.H{"status": "not ready", "checks": report})
+}
+
+// Version returns the commit and build time of the binary and the Go version it was built with
+func Version(c *gin.Context) {
+	commit, buildTime, goVersion := GitCommit, BuildTime, ""
+	modified := false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		goVersion = info.GoVersion
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if commit == "" {
+					commit = setting.Value
+				}
+			case "vcs.time":
+				if buildTime == "" {
+					buildTime = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+	if modified && GitCommit == "" && commit != "" {
+		commit += "-dirty"
+	}
+
+	c.JSON(http.StatusOK, gin.H{"commit": commit, "buildTime": buildTime, "goVersion": goVersion})
+}
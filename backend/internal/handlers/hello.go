@@ -1,11 +0,0 @@
-package handlers
-
-import (
-	"net/http"
-
-	"github.com/gin-gonic/gin"
-)
-
-func HelloWorld(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"message": "HelloWorld!"})
-}
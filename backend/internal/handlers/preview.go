@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/storage"
+	"backend/internal/thumbnail"
+	"backend/mongodb"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewBlobName names the thumbnail after the CV version (its hash), so every version keeps its own previews
+func previewBlobName(sha256 string, page int, size string) string {
+	return fmt.Sprintf("cv-%s-page%d-%s.png", sha256[:16], page, size)
+}
+
+// storePreviews generates the page image thumbnails of a CV version and saves them in the blob store.
+// A PDF without images, like a text-only CV, simply has no previews.
+func storePreviews(ctx context.Context, sha256 string, data []byte) ([]models.CVPreview, error) {
+	thumbnails, err := thumbnail.Generate(data)
+	if err != nil {
+		return nil, err
+	}
+
+	previews := []models.CVPreview{}
+	for _, thumb := range thumbnails {
+		name := previewBlobName(sha256, thumb.Page, thumb.Size)
+		if err := storage.Store.Put(ctx, name, bytes.NewReader(thumb.PNG), int64(len(thumb.PNG)), "image/png"); err != nil {
+			return nil, err
+		}
+
+		previews = append(previews, models.CVPreview{
+			Page:   thumb.Page,
+			Size:   thumb.Size,
+			Width:  thumb.Width,
+			Height: thumb.Height,
+			Blob:   name,
+		})
+	}
+
+	sort.Slice(previews, func(i, j int) bool {
+		if previews[i].Page != previews[j].Page {
+			return previews[i].Page < previews[j].Page
+		}
+		return thumbnail.Sizes[previews[i].Size] < thumbnail.Sizes[previews[j].Size]
+	})
+
+	return previews, nil
+}
+
+// deletePreviews removes the thumbnails of a replaced CV version
+func deletePreviews(ctx context.Context, upload *models.CVUpload, keep []models.CVPreview) {
+	kept := map[string]bool{}
+	for _, preview := range keep {
+		kept[preview.Blob] = true
+	}
+
+	for _, preview := range upload.Previews {
+		if kept[preview.Blob] {
+			continue
+		}
+		if err := storage.Store.Delete(ctx, preview.Blob); err != nil {
+			fmt.Println("Error deleting preview", preview.Blob, err)
+		}
+	}
+}
+
+// GetCVPreview serves a PNG thumbnail of the largest image drawn on a page of the current CV.
+// It is not a rendering of the page, text-only pages have none and answer 404.
+// GET /cv/preview?page=1&size=medium
+func GetCVPreview(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid page number"})
+		return
+	}
+
+	size := c.DefaultQuery("size", "medium")
+	if _, ok := thumbnail.Sizes[size]; !ok {
+		names := make([]string, 0, len(thumbnail.Sizes))
+		for name := range thumbnail.Sizes {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return thumbnail.Sizes[names[i]] < thumbnail.Sizes[names[j]] })
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid size, use one of: " + strings.Join(names, ", ")})
+		return
+	}
+
+	upload, err := mongodb.GetLatestCVUpload(CVFilename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get CV metadata"})
+		return
+	}
+
+	var preview *models.CVPreview
+	if upload != nil {
+		for i := range upload.Previews {
+			if upload.Previews[i].Page == page && upload.Previews[i].Size == size {
+				preview = &upload.Previews[i]
+				break
+			}
+		}
+	}
+	if preview == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No image on this page of the CV"})
+		return
+	}
+
+	reader, info, err := storage.Store.Get(c.Request.Context(), preview.Blob)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Preview not available"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to read preview"})
+		return
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to read preview"})
+		return
+	}
+
+	// The blob name changes with every CV version, so it is a strong validator
+	c.Header("Content-Type", "image/png")
+	c.Header("ETag", fmt.Sprintf("\"%s\"", preview.Blob))
+	c.Header("Cache-Control", "public, no-cache")
+
+	http.ServeContent(c.Writer, c.Request, preview.Blob, info.ModTime, bytes.NewReader(data))
+}
@@ -99,7 +99,7 @@ func GetPageTimeStats(c *gin.Context) {
 	})
 }
 
-// Get daily downloads
+// Get daily downloads, as recorded server-side by DownloadCV
 // GET /analytics/downloads?start_date=2025-01-01&end_date=2025-01-31
 func GetDownloadStats(c *gin.Context) {
 	dateFilter, err := parseDateRange(c)
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes each message in a directory, or prints it when no directory
+// is set. Used for local development, nothing is sent.
+type FileMailer struct {
+	dir string
+}
+
+// NewFileMailer creates a mailer writing the messages in dir
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if dir == "" {
+		dir = "./mails"
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("could not create mail directory: %v", err)
+	}
+	return &FileMailer{dir: dir}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, message Message) error {
+	content := fmt.Sprintf("To: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n",
+		headerValue(message.To), headerValue(message.Subject), time.Now().Format(time.RFC1123Z), message.Body)
+
+	if m.dir == "" {
+		fmt.Println("Mail not sent (log backend):\n" + content)
+		return nil
+	}
+
+	name := fmt.Sprintf("%s.eml", time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o600); err != nil {
+		return fmt.Errorf("could not write mail: %v", err)
+	}
+	return nil
+}
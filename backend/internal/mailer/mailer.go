@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"backend/internal/config"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is the interface implemented by every mail backend
+type Mailer interface {
+	// Send delivers the message, or returns an error if it could not be handed over
+	Send(ctx context.Context, message Message) error
+}
+
+// Global variable to hold the mail backend selected on startup
+var Default Mailer
+
+// InitMailer selects the mail backend of MAIL_BACKEND.
+// Supported values are "log" (default), "file" and "smtp".
+func InitMailer(cfg config.Mail) {
+	backend := cfg.Backend
+
+	var err error
+	switch backend {
+	case "log":
+		Default = &FileMailer{}
+	case "file":
+		Default, err = NewFileMailer(cfg.Dir)
+	case "smtp":
+		Default, err = NewSMTPMailer(SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword.Value(),
+			From:     cfg.From,
+		})
+	default:
+		err = fmt.Errorf("unknown mail backend %q", backend)
+	}
+
+	if err != nil {
+		log.Fatal("Failed to initialize mailer: ", err)
+	}
+
+	fmt.Println("Mailer initialized with backend:", backend)
+}
+
+// headerValue removes line breaks, so a value cannot add headers to the message
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"backend/internal/queue"
+)
+
+// OutboxSize bounds the mails waiting to be sent
+const OutboxSize = 100
+
+// SendTimeout bounds the delivery of a mail
+const SendTimeout = 30 * time.Second
+
+var (
+	outboxMu sync.Mutex
+	outbox   *queue.Queue[Message]
+)
+
+// Start starts sending the queued mails in background, it returns a function stopping
+// it once the queued mails are sent. Mails queued while no sender runs are sent by the
+// caller itself.
+func Start() (stop func()) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+
+	q := queue.Start("mail", OutboxSize, deliver)
+	outbox = q
+
+	return func() {
+		q.Stop()
+		outboxMu.Lock()
+		if outbox == q {
+			outbox = nil
+		}
+		outboxMu.Unlock()
+	}
+}
+
+// Queue sends the message with the Default backend without waiting for the delivery.
+// Delivery errors are logged.
+func Queue(message Message) {
+	outboxMu.Lock()
+	q := outbox
+	outboxMu.Unlock()
+
+	if q != nil {
+		q.Push(message)
+		return
+	}
+	deliver(message)
+}
+
+func deliver(message Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), SendTimeout)
+	defer cancel()
+
+	if err := Default.Send(ctx, message); err != nil {
+		fmt.Println("Error sending mail", err)
+	}
+}
@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds the settings of the SMTP server
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPMailer sends the messages through an SMTP server. STARTTLS is used when
+// the server offers it, authentication requires it.
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+// NewSMTPMailer checks the configuration and creates the mailer
+func NewSMTPMailer(config SMTPConfig) (*SMTPMailer, error) {
+	if config.Host == "" || config.From == "" {
+		return nil, fmt.Errorf("SMTP_HOST and MAIL_FROM are required")
+	}
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	return &SMTPMailer{config: config}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, message Message) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "From: %s\r\n", headerValue(m.config.From))
+	fmt.Fprintf(&content, "To: %s\r\n", headerValue(message.To))
+	fmt.Fprintf(&content, "Subject: %s\r\n", headerValue(message.Subject))
+	fmt.Fprintf(&content, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	content.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	content.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	// smtp.SendMail has no context, the send runs aside so the caller is not blocked past its deadline
+	done := make(chan error, 1)
+	go func() {
+		address := net.JoinHostPort(m.config.Host, m.config.Port)
+		done <- smtp.SendMail(address, auth, m.config.From, []string{message.To}, []byte(content.String()))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("could not send mail: %v", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("could not send mail: %v", ctx.Err())
+	}
+}
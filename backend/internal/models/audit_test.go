@@ -0,0 +1,39 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditEntryComputeHash(t *testing.T) {
+	entry := AuditEntry{
+		Seq:         2,
+		Action:      AuditLogin,
+		Outcome:     AuditSuccess,
+		Actor:       "root",
+		IP:          "127.0.0.1",
+		Timestamp:   time.Date(2025, 1, 31, 9, 45, 0, 0, time.UTC),
+		PrevHash:    "previous",
+		HashVersion: AuditHashKeyed,
+	}
+
+	keyed := entry.ComputeHash([]byte("secret"))
+	if keyed != entry.ComputeHash([]byte("secret")) {
+		t.Fatal("hash is not stable")
+	}
+	if keyed == entry.ComputeHash([]byte("other secret")) || keyed == entry.ComputeHash(nil) {
+		t.Fatal("hash does not depend on the key")
+	}
+
+	edited := entry
+	edited.Actor = "attacker"
+	if edited.ComputeHash([]byte("secret")) == keyed {
+		t.Fatal("editing the actor kept the hash")
+	}
+
+	unversioned := entry
+	unversioned.HashVersion = 0
+	if unversioned.ComputeHash([]byte("secret")) == keyed {
+		t.Fatal("the version is not covered by the hash")
+	}
+}
@@ -3,10 +3,29 @@ package models
 import "time"
 
 type User struct {
-	ID       string `json:"id" bson:"_id,omitempty"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Email    string `json:"email"`
+	ID          string     `json:"id" bson:"_id,omitempty"`
+	Username    string     `json:"username"`
+	Password    string     `json:"password"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role" bson:"role"`
+	Permissions []string   `json:"permissions,omitempty" bson:"permissions,omitempty"`
+	Disabled    bool       `json:"disabled" bson:"disabled"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+	// Tokens issued before this time are refused, set when the password is reset
+	SessionsRevokedAt *time.Time `json:"-" bson:"sessionsRevokedAt,omitempty"`
+	// Subject of the identity provider account linked by an OIDC login
+	OIDCSubject string `json:"-" bson:"oidcSubject,omitempty"`
+
+	// Two-factor authentication, secrets and recovery code hashes never leave the backend
+	TOTPEnabled       bool     `json:"totpEnabled" bson:"totpEnabled"`
+	TOTPSecret        string   `json:"-" bson:"totpSecret,omitempty"`
+	TOTPPendingSecret string   `json:"-" bson:"totpPendingSecret,omitempty"`
+	TOTPLastStep      int64    `json:"-" bson:"totpLastStep,omitempty"`
+	RecoveryCodes     []string `json:"-" bson:"recoveryCodes,omitempty"`
+
+	// Passkeys of the user, with PasskeyOnly password logins are refused
+	WebAuthnCredentials []WebAuthnCredential `json:"-" bson:"webauthnCredentials,omitempty"`
+	PasskeyOnly         bool                 `json:"passkeyOnly" bson:"passkeyOnly"`
 }
 
 type LoginRequest struct {
@@ -14,9 +33,117 @@ type LoginRequest struct {
 	Password   string `json:"password"`
 }
 
+type TOTPEnrollRequest struct {
+	Password string `json:"password"`
+}
+
+type TOTPCodeRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type TOTPDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken     string `json:"mfaToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type RefreshToken struct {
+	ID        string     `json:"id" bson:"_id,omitempty"`
+	TokenHash string     `json:"-" bson:"tokenHash"`
+	Family    string     `json:"family" bson:"family"`
+	Username  string     `json:"username" bson:"username"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// Session is a login of a user, shared by the refresh tokens of its family.
+// Its id is the family and the access tokens carry it in the sid claim.
+type Session struct {
+	ID         string     `json:"id" bson:"_id"`
+	Username   string     `json:"-" bson:"username"`
+	UserAgent  string     `json:"userAgent" bson:"userAgent"`
+	IP         string     `json:"ip" bson:"ip"`
+	CreatedAt  time.Time  `json:"createdAt" bson:"createdAt"`
+	LastSeenAt time.Time  `json:"lastSeenAt" bson:"lastSeenAt"`
+	ExpiresAt  time.Time  `json:"expiresAt" bson:"expiresAt"`
+	RevokedAt  *time.Time `json:"-" bson:"revokedAt,omitempty"`
+	Current    bool       `json:"current" bson:"-"`
+}
+
 type UserResponse struct {
-	ID       string `json:"id" bson:"_id,omitempty"`
+	ID          string     `json:"id" bson:"_id,omitempty"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email,omitempty" bson:"email,omitempty"`
+	Role        string     `json:"role,omitempty" bson:"role,omitempty"`
+	Permissions []string   `json:"permissions,omitempty" bson:"permissions,omitempty"`
+	Disabled    bool       `json:"disabled" bson:"disabled"`
+	TOTPEnabled bool       `json:"totpEnabled" bson:"totpEnabled"`
+	PasskeyOnly bool       `json:"passkeyOnly" bson:"passkeyOnly"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty" bson:"createdAt,omitempty"`
+}
+
+type RoleUpdateRequest struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+type InvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
 	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type Invitation struct {
+	ID        string     `json:"id" bson:"_id,omitempty"`
+	TokenHash string     `json:"-" bson:"tokenHash"`
+	Email     string     `json:"email" bson:"email"`
+	Role      string     `json:"role" bson:"role"`
+	InvitedBy string     `json:"invitedBy" bson:"invitedBy"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+	UsedBy    string     `json:"usedBy,omitempty" bson:"usedBy,omitempty"`
+}
+
+type CVUpload struct {
+	ID           string      `json:"id" bson:"_id,omitempty"`
+	Filename     string      `json:"filename" bson:"filename"`
+	Size         int64       `json:"size" bson:"size"`
+	SHA256       string      `json:"sha256" bson:"sha256"`
+	PageCount    int         `json:"pageCount" bson:"pageCount"`
+	PDFVersion   string      `json:"pdfVersion" bson:"pdfVersion"`
+	Title        string      `json:"title,omitempty" bson:"title,omitempty"`
+	Author       string      `json:"author,omitempty" bson:"author,omitempty"`
+	CreationDate *time.Time  `json:"creationDate,omitempty" bson:"creationDate,omitempty"`
+	UploadedBy   string      `json:"uploadedBy" bson:"uploadedBy"`
+	UploadedAt   time.Time   `json:"uploadedAt" bson:"uploadedAt"`
+	Previews     []CVPreview `json:"previews" bson:"previews"`
+}
+
+// CVPreview is a thumbnail of the largest image drawn on a page of the CV, pages are not rendered
+type CVPreview struct {
+	Page   int    `json:"page" bson:"page"`
+	Size   string `json:"size" bson:"size"`
+	Width  int    `json:"width" bson:"width"`
+	Height int    `json:"height" bson:"height"`
+	Blob   string `json:"-" bson:"blob"`
 }
 
 type TrackData struct {
@@ -32,6 +159,16 @@ type TrackData struct {
 	OS               *string `json:"os,omitempty" bson:"os,omitempty"`
 }
 
+type DownloadEvent struct {
+	Date      string `json:"date" bson:"date"`
+	Page      string `json:"page" bson:"page"`
+	UUID      string `json:"uuid,omitempty" bson:"uuid,omitempty"`
+	IPHash    string `json:"ipHash" bson:"ipHash"`
+	UserAgent string `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+	Referrer  string `json:"referrer,omitempty" bson:"referrer,omitempty"`
+	ETag      string `json:"etag,omitempty" bson:"etag,omitempty"`
+}
+
 type DailyUserStats struct {
 	Date        string `json:"date" bson:"_id"`
 	UniqueUsers int    `json:"uniqueUsers" bson:"uniqueUsers"`
@@ -69,3 +206,133 @@ type DateRangeFilter struct {
 	StartDate time.Time
 	EndDate   time.Time
 }
+
+// LoginThrottle counts the attempts of a key in its window. Attempts are counted when they
+// start and released when they succeed, failures drive the backoff.
+type LoginThrottle struct {
+	Key         string    `json:"-" bson:"_id"`
+	Attempts    int       `json:"attempts" bson:"attempts"`
+	Failures    int       `json:"failures" bson:"failures"`
+	LockedUntil time.Time `json:"lockedUntil" bson:"lockedUntil"`
+	ExpiresAt   time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+type SigningKey struct {
+	ID         string    `json:"kid" bson:"_id"`
+	Algorithm  string    `json:"alg" bson:"algorithm"`
+	PublicKey  string    `json:"-" bson:"publicKey"`
+	PrivateKey string    `json:"-" bson:"privateKey"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+	SignFrom   time.Time `json:"signFrom" bson:"signFrom,omitempty"`
+	RotateAt   time.Time `json:"rotateAt" bson:"rotateAt"`
+	ExpiresAt  time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+type APIKey struct {
+	ID         string     `json:"id" bson:"_id,omitempty"`
+	Name       string     `json:"name" bson:"name"`
+	Prefix     string     `json:"prefix" bson:"prefix"`
+	KeyHash    string     `json:"-" bson:"keyHash"`
+	Scopes     []string   `json:"scopes" bson:"scopes"`
+	CreatedBy  string     `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt" bson:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type PasswordReset struct {
+	ID        string     `json:"id" bson:"_id,omitempty"`
+	TokenHash string     `json:"-" bson:"tokenHash"`
+	Username  string     `json:"username" bson:"username"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+// OIDCState is a pending OIDC login, between the redirect to the provider and the callback
+type OIDCState struct {
+	StateHash    string    `json:"-" bson:"_id"`
+	BrowserHash  string    `json:"-" bson:"browserHash"`
+	Nonce        string    `json:"-" bson:"nonce"`
+	CodeVerifier string    `json:"-" bson:"codeVerifier"`
+	CreatedAt    time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt    time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// WebAuthnCredential is a passkey of a user, the public key is COSE encoded
+type WebAuthnCredential struct {
+	ID         string     `json:"id" bson:"id"`
+	Name       string     `json:"name" bson:"name"`
+	PublicKey  []byte     `json:"-" bson:"publicKey"`
+	Algorithm  int64      `json:"algorithm" bson:"algorithm"`
+	SignCount  uint32     `json:"-" bson:"signCount"`
+	Transports []string   `json:"transports,omitempty" bson:"transports,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt" bson:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+}
+
+// WebAuthnChallenge is a pending registration or login ceremony
+type WebAuthnChallenge struct {
+	ChallengeHash string    `json:"-" bson:"_id"`
+	Ceremony      string    `json:"ceremony" bson:"ceremony"`
+	Username      string    `json:"username,omitempty" bson:"username,omitempty"`
+	CreatedAt     time.Time `json:"createdAt" bson:"createdAt"`
+	ExpiresAt     time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// PublicKeyCredential is the JSON encoding of a WebAuthn credential (PublicKeyCredential.toJSON),
+// binary fields are base64url encoded
+type PublicKeyCredential struct {
+	ID       string `json:"id"`
+	RawID    string `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+		AuthenticatorData string   `json:"authenticatorData"`
+		Signature         string   `json:"signature"`
+		UserHandle        string   `json:"userHandle"`
+	} `json:"response"`
+}
+
+// PasskeyPasswordRequest confirms the password before starting a passkey registration or removing a passkey
+type PasskeyPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+type WebAuthnRegisterRequest struct {
+	Password   string              `json:"password"`
+	Name       string              `json:"name"`
+	Credential PublicKeyCredential `json:"credential"`
+}
+
+type WebAuthnLoginRequest struct {
+	Credential PublicKeyCredential `json:"credential"`
+}
+
+type PasskeyOnlyRequest struct {
+	Password string `json:"password"`
+	Enabled  bool   `json:"enabled"`
+}
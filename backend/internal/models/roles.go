@@ -0,0 +1,95 @@
+package models
+
+// Roles of the admin area users
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Permissions checked by the routes, see auth.RequirePermission
+const (
+	PermissionAnalyticsRead = "analytics:read"
+	PermissionCVWrite       = "cv:write"
+	PermissionUsersManage   = "users:manage"
+	PermissionAuditRead     = "audit:read"
+)
+
+// Analytics scopes, one per analytics route. PermissionAnalyticsRead grants all of them,
+// API keys can be limited to a subset.
+const (
+	ScopeAnalyticsDailyUsers   = "analytics:read:daily-users"
+	ScopeAnalyticsPageTime     = "analytics:read:page-time"
+	ScopeAnalyticsDownloads    = "analytics:read:downloads"
+	ScopeAnalyticsInteractions = "analytics:read:interactions"
+	ScopeAnalyticsDevices      = "analytics:read:devices"
+	ScopeAnalyticsBrowsers     = "analytics:read:browsers"
+)
+
+// APIKeyScopes lists the scopes an API key can carry, API keys are read-only
+var APIKeyScopes = []string{
+	PermissionAnalyticsRead,
+	ScopeAnalyticsDailyUsers,
+	ScopeAnalyticsPageTime,
+	ScopeAnalyticsDownloads,
+	ScopeAnalyticsInteractions,
+	ScopeAnalyticsDevices,
+	ScopeAnalyticsBrowsers,
+}
+
+// AllPermissions lists every permission known by the backend
+var AllPermissions = []string{
+	PermissionAnalyticsRead,
+	PermissionCVWrite,
+	PermissionUsersManage,
+	PermissionAuditRead,
+}
+
+// RolePermissions maps each role to the permissions it grants
+var RolePermissions = map[string][]string{
+	RoleOwner:  AllPermissions,
+	RoleEditor: {PermissionAnalyticsRead, PermissionCVWrite},
+	RoleViewer: {PermissionAnalyticsRead},
+}
+
+// IsValidRole reports whether role is one of the known roles
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// IsValidPermission reports whether permission is one of the known permissions
+func IsValidPermission(permission string) bool {
+	for _, known := range AllPermissions {
+		if known == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectivePermissions returns the permissions of the role plus the extra permissions granted to the user
+func (u *User) EffectivePermissions() []string {
+	seen := map[string]bool{}
+	permissions := []string{}
+
+	for _, permission := range append(append([]string{}, RolePermissions[u.Role]...), u.Permissions...) {
+		if seen[permission] || !IsValidPermission(permission) {
+			continue
+		}
+		seen[permission] = true
+		permissions = append(permissions, permission)
+	}
+
+	return permissions
+}
+
+// IsValidAPIKeyScope reports whether scope can be given to an API key
+func IsValidAPIKeyScope(scope string) bool {
+	for _, known := range APIKeyScopes {
+		if known == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jwk is a public key of the provider JWKS, only the fields of RSA, EC and OKP keys are read
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// keySet caches the provider keys. Unknown kids trigger a refresh, at most once per refreshInterval,
+// so a key rotation of the provider is picked up without restarting.
+type keySet struct {
+	uri        string
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	refreshedAt time.Time
+}
+
+const refreshInterval = time.Minute
+
+func newKeySet(uri string, httpClient *http.Client) *keySet {
+	return &keySet{uri: uri, httpClient: httpClient}
+}
+
+// key returns the public key of kid. An empty kid is accepted when the provider has a single key.
+func (s *keySet) key(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.lookup(keyID); ok {
+		return key, nil
+	}
+	if time.Since(s.refreshedAt) < refreshInterval {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+	if err := s.refresh(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := s.lookup(keyID); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", keyID)
+}
+
+func (s *keySet) lookup(keyID string) (crypto.PublicKey, bool) {
+	if keyID == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[keyID]
+	return key, ok
+}
+
+func (s *keySet) refresh(ctx context.Context) error {
+	s.refreshedAt = time.Now()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.uri, nil)
+	if err != nil {
+		return fmt.Errorf("could not create JWKS request: %v", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("error fetching JWKS: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS returned %d", response.StatusCode)
+	}
+	if err := decodeJSON(response, &set); err != nil {
+		return fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// Keys of unsupported types are skipped, the others stay usable
+			fmt.Println("Skipping OIDC provider key", k.KeyID, err)
+			continue
+		}
+		keys[k.KeyID] = key
+	}
+	s.keys = keys
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Curve)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(bytes) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
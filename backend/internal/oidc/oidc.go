@@ -0,0 +1,213 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/internal/config"
+)
+
+// Config describes the identity provider and the client registered on it
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Discovery is the part of the provider metadata used by the backend
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider runs the authorization code flow with PKCE against an OpenID Connect provider.
+// The metadata is discovered on first use, so the provider may be down when the backend starts.
+type Provider struct {
+	config     Config
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	discovery *Discovery
+	keys      *keySet
+}
+
+// Global variable to hold the provider, nil when OIDC login is disabled
+var Default *Provider
+
+// requestTimeout bounds each call to the provider
+const requestTimeout = 10 * time.Second
+
+// InitOIDC configures the provider. OIDC login is disabled when OIDC_ISSUER is not set.
+func InitOIDC(cfg config.OIDC) {
+	if cfg.Issuer == "" {
+		fmt.Println("OIDC login disabled (OIDC_ISSUER not set)")
+		return
+	}
+
+	Default = NewProvider(Config{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret.Value(),
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	})
+	fmt.Println("OIDC login enabled with", cfg.Issuer)
+}
+
+// NewProvider creates a provider, nothing is fetched until the first login
+func NewProvider(config Config) *Provider {
+	config.Issuer = strings.TrimRight(config.Issuer, "/")
+	return &Provider{
+		config:     config,
+		httpClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// AuthCodeURL returns the authorization endpoint URL the browser is sent to
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the verified ID token claims
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.config.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	if p.config.ClientSecret == "" {
+		// Public client, identified by its id only
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("could not create token request: %v", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(request, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging code: %v", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+
+	return p.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// discover fetches the provider metadata once, a failed attempt is retried on the next call
+func (p *Provider) discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create discovery request: %v", err)
+	}
+
+	var discovery Discovery
+	status, err := p.doJSON(request, &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching provider metadata: %v", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("provider metadata returned %d", status)
+	}
+
+	// The metadata must belong to the configured issuer, or tokens could be forged by another one
+	if strings.TrimRight(discovery.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("provider metadata issuer %q does not match %q", discovery.Issuer, p.config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("provider metadata is incomplete")
+	}
+
+	p.discovery = &discovery
+	p.keys = newKeySet(discovery.JWKSURI, p.httpClient)
+	return p.discovery, nil
+}
+
+// doJSON sends the request and decodes the JSON body. Error bodies are decoded
+// when possible, they carry the OAuth error code.
+func (p *Provider) doJSON(request *http.Request, v interface{}) (int, error) {
+	response, err := p.httpClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if err := decodeJSON(response, v); err != nil && response.StatusCode == http.StatusOK {
+		return 0, fmt.Errorf("invalid JSON response: %v", err)
+	}
+	return response.StatusCode, nil
+}
+
+// decodeJSON reads a JSON body of at most 1 MiB
+func decodeJSON(response *http.Response, v interface{}) error {
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the verifier
+func CodeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
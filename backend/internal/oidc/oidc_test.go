@@ -0,0 +1,243 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "backend"
+	testCode     = "authorization-code"
+	testVerifier = "code-verifier"
+	testNonce    = "nonce"
+)
+
+// mockProvider is an OpenID Connect provider answering the discovery, JWKS and token
+// requests. The token endpoint checks the code and its PKCE verifier, then returns the
+// ID token built by idToken.
+type mockProvider struct {
+	*httptest.Server
+	issuer  string // issuer announced by the metadata, the server URL by default
+	method  jwt.SigningMethod
+	key     crypto.Signer
+	jwk     map[string]string
+	idToken func(p *mockProvider) string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &mockProvider{
+		method: jwt.SigningMethodEdDSA,
+		key:    private,
+		jwk:    map[string]string{"kty": "OKP", "crv": "Ed25519", "kid": "k1", "x": base64.RawURLEncoding.EncodeToString(public)},
+	}
+	p.idToken = func(p *mockProvider) string { return p.sign(p.claims(), "k1") }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                p.issuer,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{p.jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("code") != testCode || CodeChallenge(r.PostForm.Get("code_verifier")) != CodeChallenge(testVerifier) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken(p)})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	p.issuer = p.URL
+	t.Cleanup(p.Close)
+	return p
+}
+
+// claims are the claims of a valid ID token
+func (p *mockProvider) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            testClientID,
+		"sub":            "subject-1",
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"nonce":          testNonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"groups":         []string{"developers", "staff"},
+	}
+}
+
+func (p *mockProvider) sign(claims jwt.MapClaims, keyID string) string {
+	token := jwt.NewWithClaims(p.method, claims)
+	token.Header["kid"] = keyID
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (p *mockProvider) provider() *Provider {
+	return NewProvider(Config{Issuer: p.URL, ClientID: testClientID, RedirectURL: "https://app.example.com/oidc/callback", Scopes: []string{"openid", "email"}})
+}
+
+func withClaims(change func(claims jwt.MapClaims)) func(p *mockProvider) string {
+	return func(p *mockProvider) string {
+		claims := p.claims()
+		change(claims)
+		return p.sign(claims, "k1")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	tests := []struct {
+		name     string
+		idToken  func(p *mockProvider) string
+		verifier string
+		ok       bool
+	}{
+		{"valid", nil, testVerifier, true},
+		{"wrong code verifier", nil, "other-verifier", false},
+		{"wrong nonce", withClaims(func(c jwt.MapClaims) { c["nonce"] = "other" }), testVerifier, false},
+		{"missing nonce", withClaims(func(c jwt.MapClaims) { delete(c, "nonce") }), testVerifier, false},
+		{"other audience", withClaims(func(c jwt.MapClaims) { c["aud"] = "other-client" }), testVerifier, false},
+		{"several audiences without azp", withClaims(func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other"} }), testVerifier, false},
+		{"several audiences with azp", withClaims(func(c jwt.MapClaims) { c["aud"] = []string{testClientID, "other"}; c["azp"] = testClientID }), testVerifier, true},
+		{"other issuer", withClaims(func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }), testVerifier, false},
+		{"expired", withClaims(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), testVerifier, false},
+		{"no expiration", withClaims(func(c jwt.MapClaims) { delete(c, "exp") }), testVerifier, false},
+		{"no subject", withClaims(func(c jwt.MapClaims) { delete(c, "sub") }), testVerifier, false},
+		{"unknown key", func(p *mockProvider) string { return p.sign(p.claims(), "k2") }, testVerifier, false},
+		{"hmac signed", func(p *mockProvider) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, p.claims())
+			token.Header["kid"] = "k1"
+			signed, _ := token.SignedString([]byte(p.jwk["x"]))
+			return signed
+		}, testVerifier, false},
+		{"unsigned", func(p *mockProvider) string {
+			signed, _ := jwt.NewWithClaims(jwt.SigningMethodNone, p.claims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}, testVerifier, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock := newMockProvider(t)
+			if test.idToken != nil {
+				mock.idToken = test.idToken
+			}
+
+			claims, err := mock.provider().Exchange(context.Background(), testCode, test.verifier, testNonce)
+			if !test.ok {
+				if err == nil {
+					t.Fatal("Exchange succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if claims.Subject != "subject-1" || claims.Email != "jane@example.com" || !claims.EmailVerified {
+				t.Fatalf("claims = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestExchangeRSAKey(t *testing.T) {
+	mock := newMockProvider(t)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock.method, mock.key = jwt.SigningMethodRS256, key
+	mock.jwk = map[string]string{
+		"kty": "RSA", "kid": "k1", "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+
+	if _, err := mock.provider().Exchange(context.Background(), testCode, testVerifier, testNonce); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+}
+
+func TestClaims(t *testing.T) {
+	mock := newMockProvider(t)
+	mock.idToken = withClaims(func(c jwt.MapClaims) {
+		c["email_verified"] = "false"
+		c["realm_access"] = map[string]interface{}{"roles": []string{"admins"}}
+	})
+
+	claims, err := mock.provider().Exchange(context.Background(), testCode, testVerifier, testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.EmailVerified {
+		t.Error(`email_verified "false" read as verified`)
+	}
+	if got := claims.Values("groups"); strings.Join(got, ",") != "developers,staff" {
+		t.Errorf("Values(groups) = %v", got)
+	}
+	if got := claims.Values("realm_access.roles"); strings.Join(got, ",") != "admins" {
+		t.Errorf("Values(realm_access.roles) = %v", got)
+	}
+	if got := claims.Values("missing.claim"); got != nil {
+		t.Errorf("Values(missing.claim) = %v, want nil", got)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	mock := newMockProvider(t)
+
+	authURL, err := mock.provider().AuthCodeURL(context.Background(), "state", testNonce, testVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if parsed.Path != "/authorize" || query.Get("state") != "state" || query.Get("nonce") != testNonce ||
+		query.Get("code_challenge") != CodeChallenge(testVerifier) || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("AuthCodeURL = %s", authURL)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	mock := newMockProvider(t)
+	mock.issuer = "https://evil.example.com"
+
+	if _, err := mock.provider().AuthCodeURL(context.Background(), "state", testNonce, testVerifier); err == nil {
+		t.Fatal("metadata of another issuer accepted")
+	}
+}
@@ -0,0 +1,109 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingMethods are the ID token algorithms accepted, "none" and HMAC are never accepted
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// clockSkew tolerates small clock differences with the provider
+const clockSkew = time.Minute
+
+// Claims are the verified claims of an ID token
+type Claims struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+
+	raw jwt.MapClaims
+}
+
+// Values returns the values of a string or string array claim. Nested claims are
+// addressed with dots, as realm_access.roles.
+func (c *Claims) Values(name string) []string {
+	var value interface{} = map[string]interface{}(c.raw)
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// Verify checks the signature, issuer, audience, lifetime and nonce of an ID token
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, raw, func(token *jwt.Token) (interface{}, error) {
+		keyID, _ := token.Header["kid"].(string)
+		return p.keys.key(ctx, keyID)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	// With several audiences the token must name the client as authorized party
+	audience, _ := raw.GetAudience()
+	authorizedParty, _ := raw["azp"].(string)
+	if (len(audience) > 1 || authorizedParty != "") && authorizedParty != p.config.ClientID {
+		return nil, fmt.Errorf("invalid ID token: authorized party %q", authorizedParty)
+	}
+
+	if tokenNonce, _ := raw["nonce"].(string); nonce == "" || tokenNonce != nonce {
+		return nil, fmt.Errorf("invalid ID token: nonce mismatch")
+	}
+
+	claims := &Claims{raw: raw}
+	claims.Subject, _ = raw.GetSubject()
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("invalid ID token: missing subject")
+	}
+	claims.Email, _ = raw["email"].(string)
+	claims.Name, _ = raw["name"].(string)
+	claims.PreferredUsername, _ = raw["preferred_username"].(string)
+
+	// Some providers send email_verified as a string
+	switch verified := raw["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = verified
+	case string:
+		claims.EmailVerified = verified == "true"
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,47 @@
+package passwords
+
+import (
+	_ "embed"
+	"strings"
+)
+
+//go:embed common-passwords.txt
+var commonPasswordsList string
+
+// commonPasswords is the embedded list, loaded once
+var commonPasswords = parseList(commonPasswordsList)
+
+// leetReplacer reverts the usual character substitutions, p@ssw0rd becomes password
+var leetReplacer = strings.NewReplacer("@", "a", "4", "a", "3", "e", "1", "i", "!", "i", "0", "o", "$", "s", "5", "s", "7", "t")
+
+// IsCommon reports whether the password, or its base word, is in the list of common
+// and breached passwords. The base word is the password without its trailing digits and
+// symbols and without character substitutions, so Summer2024! is refused like summer.
+func IsCommon(password string) bool {
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return true
+	}
+
+	base := strings.TrimRightFunc(lower, func(r rune) bool { return !isLetter(r) })
+	if base == "" {
+		return false
+	}
+	return commonPasswords[base] || commonPasswords[leetReplacer.Replace(base)]
+}
+
+func isLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r == '@' || r == '$'
+}
+
+func parseList(list string) map[string]bool {
+	passwords := map[string]bool{}
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = true
+	}
+	return passwords
+}
@@ -0,0 +1,113 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Params are the argon2id parameters of new hashes. They are part of the encoded hash,
+// so changing them does not break the existing hashes, which are upgraded on login.
+type Params struct {
+	Memory     uint32 // KiB
+	Time       uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultParams follow the OWASP recommendation for argon2id
+var DefaultParams = Params{Memory: 64 * 1024, Time: 3, Threads: 2, SaltLength: 16, KeyLength: 32}
+
+var currentParams = DefaultParams
+
+// SetParams sets the parameters of new hashes, from the configuration on startup
+func SetParams(params Params) {
+	currentParams = params
+}
+
+// CurrentParams returns the parameters of new hashes, DefaultParams unless set by SetParams
+func CurrentParams() Params {
+	return currentParams
+}
+
+// Hash returns the argon2id hash of the password in the PHC string format:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func Hash(password string) (string, error) {
+	params := CurrentParams()
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("could not read random bytes: %v", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Time, params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify reports whether the password matches the encoded hash, and whether the hash
+// should be replaced because its algorithm or parameters are outdated.
+// Legacy bcrypt hashes are still verified, and always need a rehash.
+func Verify(password, encoded string) (match bool, needsRehash bool) {
+	if isBcrypt(encoded) {
+		return bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password)) == nil, true
+	}
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, false
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	if subtle.ConstantTimeCompare(computed, key) != 1 {
+		return false, false
+	}
+
+	current := CurrentParams()
+	outdated := params.Memory != current.Memory || params.Time != current.Time || params.Threads != current.Threads ||
+		params.KeyLength != current.KeyLength || uint32(len(salt)) < current.SaltLength
+	return true, outdated
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// decodeArgon2id parses a PHC argon2id hash. Only the current version of the algorithm is accepted.
+func decodeArgon2id(encoded string) (Params, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return Params{}, nil, nil, fmt.Errorf("unsupported password hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Params{}, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+
+	var params Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return Params{}, nil, nil, fmt.Errorf("invalid argon2 parameters: %v", err)
+	}
+	if params.Memory == 0 || params.Time == 0 || params.Threads == 0 {
+		return Params{}, nil, nil, fmt.Errorf("invalid argon2 parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("invalid argon2 salt: %v", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Params{}, nil, nil, fmt.Errorf("invalid argon2 key")
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
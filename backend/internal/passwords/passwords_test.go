@@ -0,0 +1,111 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testParams keep the hashes of the tests cheap
+var testParams = Params{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+func useParams(t *testing.T, params Params) {
+	t.Helper()
+	previous := CurrentParams()
+	SetParams(params)
+	t.Cleanup(func() { SetParams(previous) })
+}
+
+func TestVerify(t *testing.T) {
+	useParams(t, testParams)
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("Correct-Horse-42"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Hash("Correct-Horse-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetParams(Params{Memory: 2048, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32})
+	moreMemory, _ := Hash("Correct-Horse-42")
+	SetParams(Params{Memory: 1024, Time: 1, Threads: 1, SaltLength: 8, KeyLength: 32})
+	shortSalt, _ := Hash("Correct-Horse-42")
+	SetParams(testParams)
+
+	parts := strings.Split(current, "$")
+	invalidSalt := strings.Join([]string{"", parts[1], parts[2], parts[3], "!!!", parts[5]}, "$")
+
+	tests := []struct {
+		name        string
+		password    string
+		encoded     string
+		match       bool
+		needsRehash bool
+	}{
+		{"current argon2id", "Correct-Horse-42", current, true, false},
+		{"wrong password", "Correct-Horse-43", current, false, false},
+		{"bcrypt", "Correct-Horse-42", string(bcryptHash), true, true},
+		{"bcrypt wrong password", "wrong", string(bcryptHash), false, true},
+		{"other memory", "Correct-Horse-42", moreMemory, true, true},
+		{"shorter salt", "Correct-Horse-42", shortSalt, true, true},
+		{"other algorithm", "Correct-Horse-42", strings.Replace(current, "$argon2id$", "$argon2i$", 1), false, false},
+		{"other version", "Correct-Horse-42", strings.Replace(current, "$v=19$", "$v=16$", 1), false, false},
+		{"missing part", "Correct-Horse-42", current[:strings.LastIndex(current, "$")], false, false},
+		{"zero parameters", "Correct-Horse-42", strings.Replace(current, "t=1", "t=0", 1), false, false},
+		{"invalid parameters", "Correct-Horse-42", strings.Replace(current, "$m=", "$m=x", 1), false, false},
+		{"invalid salt", "Correct-Horse-42", invalidSalt, false, false},
+		{"empty", "Correct-Horse-42", "", false, false},
+	}
+	for _, test := range tests {
+		match, needsRehash := Verify(test.password, test.encoded)
+		if match != test.match || needsRehash != test.needsRehash {
+			t.Errorf("%s: Verify = %v, %v, want %v, %v", test.name, match, needsRehash, test.match, test.needsRehash)
+		}
+	}
+}
+
+func TestVerifyChangedParams(t *testing.T) {
+	useParams(t, testParams)
+	encoded, err := Hash("Correct-Horse-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes := []Params{
+		{Memory: 2048, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32},
+		{Memory: 1024, Time: 2, Threads: 1, SaltLength: 16, KeyLength: 32},
+		{Memory: 1024, Time: 1, Threads: 2, SaltLength: 16, KeyLength: 32},
+		{Memory: 1024, Time: 1, Threads: 1, SaltLength: 32, KeyLength: 32},
+		{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 64},
+	}
+	for _, params := range changes {
+		SetParams(params)
+		if match, needsRehash := Verify("Correct-Horse-42", encoded); !match || !needsRehash {
+			t.Errorf("params %+v: Verify = %v, %v, want a match needing a rehash", params, match, needsRehash)
+		}
+	}
+}
+
+func TestIsCommon(t *testing.T) {
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"PASSWORD", true},
+		{"p@ssw0rd", true},
+		{"Summer2024!", true},
+		{"summer", true},
+		{"Dr4gon!!", true},
+		{"Correct-Horse-42", false},
+		{"2024!", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := IsCommon(test.password); got != test.want {
+			t.Errorf("IsCommon(%q) = %v, want %v", test.password, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,707 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// maxDecodedSize limits the size of a decoded stream and maxDocumentDecodedSize the total
+// decoded by a document, to protect against compression bombs
+const (
+	maxDecodedSize         = 64 * 1024 * 1024
+	maxDocumentDecodedSize = 256 * 1024 * 1024
+)
+
+type xrefEntry struct {
+	free      bool
+	offset    int64
+	inStream  bool
+	streamNum int
+	index     int
+}
+
+// Document is a parsed PDF file. Objects are loaded lazily through the cross-reference table.
+type Document struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	Trailer Dict
+	Version string
+
+	cache     map[int]Object
+	resolving map[int]bool
+	// decoded object streams, every object of a stream is read from the same data
+	objectStreams map[int][]byte
+	// bytes inflated so far, checked against maxDocumentDecodedSize
+	decoded int64
+}
+
+// Parse reads the header, the cross-reference sections and the trailer of a PDF file.
+// Both classic xref tables and cross-reference streams (PDF 1.5+) are supported.
+func Parse(data []byte) (*Document, error) {
+	// The header must be near the start of the file
+	headerLimit := len(data)
+	if headerLimit > 1024 {
+		headerLimit = 1024
+	}
+	headerPos := bytes.Index(data[:headerLimit], []byte("%PDF-"))
+	if headerPos < 0 {
+		return nil, fmt.Errorf("missing %%PDF header")
+	}
+
+	doc := &Document{
+		data:          data,
+		xref:          map[int]xrefEntry{},
+		cache:         map[int]Object{},
+		resolving:     map[int]bool{},
+		objectStreams: map[int][]byte{},
+	}
+
+	versionEnd := headerPos + 5
+	for versionEnd < len(data) && (isDigit(data[versionEnd]) || data[versionEnd] == '.') {
+		versionEnd++
+	}
+	doc.Version = string(data[headerPos+5 : versionEnd])
+
+	offset, err := doc.startXref()
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk the chain of xref sections from the newest to the oldest.
+	// Entries of newer sections take precedence.
+	visited := map[int64]bool{}
+	for {
+		if visited[offset] {
+			return nil, fmt.Errorf("cross-reference sections form a loop")
+		}
+		visited[offset] = true
+
+		trailer, err := doc.readXrefSection(offset)
+		if err != nil {
+			return nil, err
+		}
+		if doc.Trailer == nil {
+			doc.Trailer = trailer
+		}
+
+		// Hybrid files keep part of the entries in a separate xref stream
+		if streamOffset, ok := trailer.Int("XRefStm"); ok && !visited[streamOffset] {
+			visited[streamOffset] = true
+			if _, err := doc.readXrefSection(streamOffset); err != nil {
+				return nil, err
+			}
+		}
+
+		prev, ok := trailer.Int("Prev")
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+
+	if _, ok := doc.Trailer["Root"]; !ok {
+		return nil, fmt.Errorf("trailer has no /Root entry")
+	}
+
+	return doc, nil
+}
+
+func (d *Document) startXref() (int64, error) {
+	pos := bytes.LastIndex(d.data, []byte("startxref"))
+	if pos < 0 {
+		return 0, fmt.Errorf("missing startxref")
+	}
+
+	lex := &lexer{data: d.data, pos: pos + len("startxref")}
+	tok, err := lex.next()
+	if err != nil || tok.kind != tokNumber || !tok.isInt {
+		return 0, fmt.Errorf("invalid startxref offset")
+	}
+
+	return tok.intVal, nil
+}
+
+func (d *Document) readXrefSection(offset int64) (Dict, error) {
+	if offset < 0 || offset >= int64(len(d.data)) {
+		return nil, fmt.Errorf("cross-reference offset %d out of range", offset)
+	}
+
+	lex := &lexer{data: d.data, pos: int(offset)}
+	lex.skipSpace()
+	if bytes.HasPrefix(d.data[lex.pos:], []byte("xref")) {
+		lex.pos += len("xref")
+		return d.readXrefTable(lex)
+	}
+
+	return d.readXrefStream(offset)
+}
+
+func (d *Document) readXrefTable(lex *lexer) (Dict, error) {
+	for {
+		tok, err := lex.next()
+		if err != nil {
+			return nil, err
+		}
+
+		if tok.kind == tokKeyword && tok.text == "trailer" {
+			p := &parser{lex: lex}
+			obj, err := p.parseObject()
+			if err != nil {
+				return nil, fmt.Errorf("invalid trailer: %v", err)
+			}
+			trailer, ok := obj.(Dict)
+			if !ok {
+				return nil, fmt.Errorf("trailer is not a dictionary")
+			}
+			return trailer, nil
+		}
+
+		// Subsection header "first count"
+		if tok.kind != tokNumber || !tok.isInt {
+			return nil, fmt.Errorf("invalid cross-reference table at offset %d", lex.pos)
+		}
+		countTok, err := lex.next()
+		if err != nil || countTok.kind != tokNumber || !countTok.isInt {
+			return nil, fmt.Errorf("invalid cross-reference subsection at offset %d", lex.pos)
+		}
+
+		first := int(tok.intVal)
+		for i := 0; i < int(countTok.intVal); i++ {
+			// Each entry is "offset generation n|f"
+			offsetTok, err1 := lex.next()
+			_, err2 := lex.next()
+			kindTok, err3 := lex.next()
+			if err1 != nil || err2 != nil || err3 != nil || offsetTok.kind != tokNumber || kindTok.kind != tokKeyword {
+				return nil, fmt.Errorf("invalid cross-reference entry at offset %d", lex.pos)
+			}
+
+			// Free entries of newer sections hide objects deleted by an incremental update
+			num := first + i
+			if _, exists := d.xref[num]; exists {
+				continue
+			}
+			d.xref[num] = xrefEntry{free: kindTok.text != "n", offset: offsetTok.intVal}
+		}
+	}
+}
+
+func (d *Document) readXrefStream(offset int64) (Dict, error) {
+	obj, _, err := d.parseIndirect(offset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cross-reference stream: %v", err)
+	}
+
+	stream, ok := obj.(*Stream)
+	if !ok || stream.Dict.Name("Type") != "XRef" {
+		return nil, fmt.Errorf("startxref does not point to a cross-reference section")
+	}
+
+	data, err := d.Decode(stream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cross-reference stream: %v", err)
+	}
+
+	widthsArray, _ := stream.Dict["W"].(Array)
+	if len(widthsArray) != 3 {
+		return nil, fmt.Errorf("invalid /W in cross-reference stream")
+	}
+	var widths [3]int
+	for i, w := range widthsArray {
+		value, ok := w.(int64)
+		if !ok || value < 0 || value > 8 {
+			return nil, fmt.Errorf("invalid /W in cross-reference stream")
+		}
+		widths[i] = int(value)
+	}
+	entrySize := widths[0] + widths[1] + widths[2]
+	if entrySize == 0 {
+		return nil, fmt.Errorf("invalid /W in cross-reference stream")
+	}
+
+	size, _ := stream.Dict.Int("Size")
+	index := Array{int64(0), size}
+	if value, ok := stream.Dict["Index"].(Array); ok {
+		index = value
+	}
+	if len(index)%2 != 0 {
+		return nil, fmt.Errorf("invalid /Index in cross-reference stream")
+	}
+
+	pos := 0
+	for i := 0; i < len(index); i += 2 {
+		first, ok1 := index[i].(int64)
+		count, ok2 := index[i+1].(int64)
+		if !ok1 || !ok2 || count < 0 {
+			return nil, fmt.Errorf("invalid /Index in cross-reference stream")
+		}
+
+		for j := int64(0); j < count; j++ {
+			if pos+entrySize > len(data) {
+				return nil, fmt.Errorf("cross-reference stream is truncated")
+			}
+
+			fields := [3]int64{1, 0, 0} // type defaults to 1 when its width is zero
+			for k := 0; k < 3; k++ {
+				if widths[k] == 0 {
+					continue
+				}
+				var value int64
+				for _, b := range data[pos : pos+widths[k]] {
+					value = value<<8 | int64(b)
+				}
+				fields[k] = value
+				pos += widths[k]
+			}
+
+			num := int(first + j)
+			if _, exists := d.xref[num]; exists {
+				continue
+			}
+			switch fields[0] {
+			case 0:
+				d.xref[num] = xrefEntry{free: true}
+			case 1:
+				d.xref[num] = xrefEntry{offset: fields[1]}
+			case 2:
+				d.xref[num] = xrefEntry{inStream: true, streamNum: int(fields[1]), index: int(fields[2])}
+			}
+		}
+	}
+
+	return stream.Dict, nil
+}
+
+// parseIndirect parses "num gen obj ... endobj" at the given offset and returns the object and its number
+func (d *Document) parseIndirect(offset int64) (Object, int, error) {
+	if offset < 0 || offset >= int64(len(d.data)) {
+		return nil, 0, fmt.Errorf("object offset %d out of range", offset)
+	}
+
+	lex := &lexer{data: d.data, pos: int(offset)}
+	numTok, err1 := lex.next()
+	_, err2 := lex.next()
+	objTok, err3 := lex.next()
+	if err1 != nil || err2 != nil || err3 != nil || numTok.kind != tokNumber || !numTok.isInt || objTok.kind != tokKeyword || objTok.text != "obj" {
+		return nil, 0, fmt.Errorf("no object found at offset %d", offset)
+	}
+	num := int(numTok.intVal)
+
+	p := &parser{lex: lex}
+	obj, err := p.parseObject()
+	if err != nil {
+		return nil, num, fmt.Errorf("object %d: %v", num, err)
+	}
+
+	save := lex.pos
+	tok, err := lex.next()
+	if err != nil || tok.kind != tokKeyword || tok.text != "stream" {
+		// "endobj" is expected here, but a missing one is tolerated like in most readers
+		lex.pos = save
+		return obj, num, nil
+	}
+
+	dict, ok := obj.(Dict)
+	if !ok {
+		return nil, num, fmt.Errorf("object %d: stream without dictionary", num)
+	}
+
+	// Stream data starts after the end of line following the keyword
+	start := lex.pos
+	if start < len(d.data) && d.data[start] == '\r' {
+		start++
+	}
+	if start < len(d.data) && d.data[start] == '\n' {
+		start++
+	}
+
+	raw, err := d.streamData(dict, num, start)
+	if err != nil {
+		return nil, num, err
+	}
+
+	return &Stream{Dict: dict, Raw: raw}, num, nil
+}
+
+func (d *Document) streamData(dict Dict, num int, start int) ([]byte, error) {
+	// Trust /Length when it is consistent with the position of "endstream"
+	var length int64 = -1
+	switch value := dict["Length"].(type) {
+	case int64:
+		length = value
+	case Ref:
+		if value.Num != num {
+			if resolved, err := d.Object(value.Num); err == nil {
+				if n, ok := resolved.(int64); ok {
+					length = n
+				}
+			}
+		}
+	}
+
+	if length >= 0 && int64(start)+length <= int64(len(d.data)) {
+		end := start + int(length)
+		rest := &lexer{data: d.data, pos: end}
+		rest.skipSpace()
+		if bytes.HasPrefix(d.data[rest.pos:], []byte("endstream")) {
+			return d.data[start:end], nil
+		}
+	}
+
+	end := bytes.Index(d.data[start:], []byte("endstream"))
+	if end < 0 {
+		return nil, fmt.Errorf("object %d: unterminated stream", num)
+	}
+	raw := d.data[start : start+end]
+	raw = bytes.TrimSuffix(raw, []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	return raw, nil
+}
+
+// ObjectNumbers returns the numbers of all the objects listed in the cross-reference table
+func (d *Document) ObjectNumbers() []int {
+	nums := make([]int, 0, len(d.xref))
+	for num, entry := range d.xref {
+		if !entry.free {
+			nums = append(nums, num)
+		}
+	}
+	return nums
+}
+
+// Object loads an object by number. Objects missing from the xref table are null.
+func (d *Document) Object(num int) (Object, error) {
+	if obj, ok := d.cache[num]; ok {
+		return obj, nil
+	}
+
+	entry, ok := d.xref[num]
+	if !ok || entry.free {
+		return nil, nil
+	}
+
+	if d.resolving[num] {
+		return nil, fmt.Errorf("object %d references itself", num)
+	}
+	d.resolving[num] = true
+	defer delete(d.resolving, num)
+
+	var obj Object
+	var err error
+	if entry.inStream {
+		obj, err = d.objectFromStream(num, entry)
+	} else {
+		var found int
+		obj, found, err = d.parseIndirect(entry.offset)
+		if err == nil && found != num {
+			err = fmt.Errorf("cross-reference entry for object %d points to object %d", num, found)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.cache[num] = obj
+	return obj, nil
+}
+
+func (d *Document) objectFromStream(num int, entry xrefEntry) (Object, error) {
+	container, err := d.Object(entry.streamNum)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, ok := container.(*Stream)
+	if !ok || stream.Dict.Name("Type") != "ObjStm" {
+		return nil, fmt.Errorf("object %d: object stream %d is invalid", num, entry.streamNum)
+	}
+
+	data, ok := d.objectStreams[entry.streamNum]
+	if !ok {
+		data, err = d.Decode(stream)
+		if err != nil {
+			return nil, fmt.Errorf("object stream %d: %v", entry.streamNum, err)
+		}
+		d.objectStreams[entry.streamNum] = data
+	}
+
+	count, _ := stream.Dict.Int("N")
+	first, _ := stream.Dict.Int("First")
+	if entry.index < 0 || int64(entry.index) >= count || first < 0 || first > int64(len(data)) {
+		return nil, fmt.Errorf("object %d: invalid object stream index", num)
+	}
+
+	// The header is a list of "num offset" pairs
+	lex := &lexer{data: data[:first]}
+	for i := 0; i <= entry.index; i++ {
+		numTok, err1 := lex.next()
+		offsetTok, err2 := lex.next()
+		if err1 != nil || err2 != nil || numTok.kind != tokNumber || offsetTok.kind != tokNumber {
+			return nil, fmt.Errorf("object stream %d: invalid header", entry.streamNum)
+		}
+		if i < entry.index {
+			continue
+		}
+		if int(numTok.intVal) != num {
+			return nil, fmt.Errorf("object stream %d: expected object %d, found %d", entry.streamNum, num, numTok.intVal)
+		}
+
+		pos := first + offsetTok.intVal
+		if pos < 0 || pos >= int64(len(data)) {
+			return nil, fmt.Errorf("object %d: offset out of range", num)
+		}
+		p := &parser{lex: &lexer{data: data, pos: int(pos)}}
+		obj, err := p.parseObject()
+		if err != nil {
+			return nil, fmt.Errorf("object %d: %v", num, err)
+		}
+		return obj, nil
+	}
+
+	return nil, fmt.Errorf("object %d not found in object stream %d", num, entry.streamNum)
+}
+
+// Resolve follows indirect references until a direct object is found
+func (d *Document) Resolve(obj Object) (Object, error) {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(Ref)
+		if !ok {
+			return obj, nil
+		}
+		var err error
+		obj, err = d.Object(ref.Num)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("too many levels of indirection")
+}
+
+// ResolveDict resolves obj and returns it as a dictionary, or nil if it is not one
+func (d *Document) ResolveDict(obj Object) Dict {
+	resolved, err := d.Resolve(obj)
+	if err != nil {
+		return nil
+	}
+	switch value := resolved.(type) {
+	case Dict:
+		return value
+	case *Stream:
+		return value.Dict
+	}
+	return nil
+}
+
+// Decode applies the filters of the stream and returns the decoded data.
+// Only the filters needed to read the document structure are supported.
+func (d *Document) Decode(stream *Stream) ([]byte, error) {
+	filters, params := d.filters(stream.Dict)
+	data := stream.Raw
+
+	for i, filter := range filters {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = d.flateDecode(data, d.ResolveDict(params[i]))
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		default:
+			return nil, fmt.Errorf("unsupported filter %s", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (d *Document) filters(dict Dict) ([]Name, []Object) {
+	var filters []Name
+	var params []Object
+
+	filter, _ := d.Resolve(dict["Filter"])
+	decodeParms, _ := d.Resolve(dict["DecodeParms"])
+
+	switch value := filter.(type) {
+	case Name:
+		filters = []Name{value}
+		params = []Object{decodeParms}
+	case Array:
+		parmsArray, _ := decodeParms.(Array)
+		for i, item := range value {
+			name, _ := item.(Name)
+			filters = append(filters, name)
+			if i < len(parmsArray) {
+				params = append(params, parmsArray[i])
+			} else {
+				params = append(params, nil)
+			}
+		}
+	}
+
+	return filters, params
+}
+
+// flateDecode inflates a stream, counting its size in the decoded bytes of the document
+func (d *Document) flateDecode(data []byte, params Dict) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid compressed stream: %v", err)
+	}
+	defer reader.Close()
+
+	limit := min(int64(maxDecodedSize), maxDocumentDecodedSize-d.decoded)
+	decoded, err := io.ReadAll(io.LimitReader(reader, limit+1))
+	d.decoded += int64(len(decoded))
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("invalid compressed stream: %v", err)
+	}
+	if int64(len(decoded)) > limit {
+		if limit < maxDecodedSize {
+			return nil, fmt.Errorf("document decodes to more than %d MB", maxDocumentDecodedSize/(1024*1024))
+		}
+		return nil, fmt.Errorf("decoded stream too large")
+	}
+
+	predictor, _ := params.Int("Predictor")
+	if predictor <= 1 {
+		return decoded, nil
+	}
+	if predictor < 10 {
+		return nil, fmt.Errorf("unsupported predictor %d", predictor)
+	}
+
+	columns := int64(1)
+	if value, ok := params.Int("Columns"); ok {
+		columns = value
+	}
+	colors := int64(1)
+	if value, ok := params.Int("Colors"); ok {
+		colors = value
+	}
+	bpc := int64(8)
+	if value, ok := params.Int("BitsPerComponent"); ok {
+		bpc = value
+	}
+
+	return pngUnpredict(decoded, int((columns*colors*bpc+7)/8), int((colors*bpc+7)/8))
+}
+
+// pngUnpredict reverses the PNG row filters used by the Predictor parameter
+func pngUnpredict(data []byte, rowSize, pixelSize int) ([]byte, error) {
+	if rowSize <= 0 || pixelSize <= 0 {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+
+	var out []byte
+	prev := make([]byte, rowSize)
+	for pos := 0; pos+rowSize+1 <= len(data); pos += rowSize + 1 {
+		filter := data[pos]
+		row := make([]byte, rowSize)
+		copy(row, data[pos+1:pos+1+rowSize])
+
+		for i := 0; i < rowSize; i++ {
+			var left, upLeft byte
+			if i >= pixelSize {
+				left = row[i-pixelSize]
+				upLeft = prev[i-pixelSize]
+			}
+			up := prev[i]
+
+			switch filter {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("invalid PNG predictor %d", filter)
+			}
+		}
+
+		out = append(out, row...)
+		prev = row
+	}
+
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, b := range data {
+		if b == '>' {
+			break
+		}
+		if isWhitespace(b) {
+			continue
+		}
+		digits = append(digits, b)
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	decoded, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex stream: %v", err)
+	}
+	return decoded, nil
+}
+
+// TextString decodes a PDF text string, which is either UTF-16BE with a BOM or PDFDocEncoding
+func TextString(obj Object) string {
+	str, ok := obj.(String)
+	if !ok {
+		return ""
+	}
+
+	if len(str) >= 2 && str[0] == 0xFE && str[1] == 0xFF {
+		var runes []rune
+		for i := 2; i+1 < len(str); i += 2 {
+			r := rune(str[i])<<8 | rune(str[i+1])
+			// Combine surrogate pairs
+			if r >= 0xD800 && r < 0xDC00 && i+3 < len(str) {
+				low := rune(str[i+2])<<8 | rune(str[i+3])
+				if low >= 0xDC00 && low < 0xE000 {
+					r = (r-0xD800)<<10 + (low - 0xDC00) + 0x10000
+					i += 2
+				}
+			}
+			runes = append(runes, r)
+		}
+		return string(runes)
+	}
+
+	// PDFDocEncoding matches Latin-1 for the printable range
+	runes := make([]rune, len(str))
+	for i, b := range str {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
@@ -0,0 +1,298 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// ErrNoImage is returned when a page does not draw any image that can be decoded
+var ErrNoImage = errors.New("page has no supported image")
+
+// maxImagePixels bounds the decoded images, 50 megapixels is 200 MB in RGBA
+const maxImagePixels = 50_000_000
+
+// Pages returns the page dictionaries in document order.
+// Inherited /Resources are copied into each page.
+func (d *Document) Pages() ([]Dict, error) {
+	root := d.ResolveDict(d.Trailer["Root"])
+	if root == nil {
+		return nil, fmt.Errorf("missing document catalog")
+	}
+
+	var pages []Dict
+	visited := map[Ref]bool{}
+
+	var walk func(node Object, resources Object, depth int) error
+	walk = func(node Object, resources Object, depth int) error {
+		if depth > maxDepth {
+			return fmt.Errorf("page tree nested too deeply")
+		}
+		if ref, ok := node.(Ref); ok {
+			if visited[ref] {
+				return fmt.Errorf("page tree contains a loop")
+			}
+			visited[ref] = true
+		}
+
+		dict := d.ResolveDict(node)
+		if dict == nil {
+			return fmt.Errorf("invalid page tree node")
+		}
+		if value, ok := dict["Resources"]; ok {
+			resources = value
+		}
+
+		if dict.Name("Type") == "Page" {
+			page := Dict{}
+			for key, value := range dict {
+				page[key] = value
+			}
+			page["Resources"] = resources
+			pages = append(pages, page)
+			return nil
+		}
+
+		kids, _ := d.Resolve(dict["Kids"])
+		kidsArray, _ := kids.(Array)
+		for _, kid := range kidsArray {
+			if err := walk(kid, resources, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(root["Pages"], nil, 0); err != nil {
+		return nil, err
+	}
+
+	return pages, nil
+}
+
+// LargestImage returns the largest image XObject used by the page, looking into form XObjects too.
+// It is not a rendering of the page: text and vector content are ignored, and a page drawing
+// no image returns ErrNoImage.
+func (d *Document) LargestImage(page Dict) (image.Image, error) {
+	var best *Stream
+	bestArea := int64(0)
+	visited := map[Ref]bool{}
+
+	var scan func(resources Object, depth int)
+	scan = func(resources Object, depth int) {
+		if depth > 4 {
+			return
+		}
+		xobjects := d.ResolveDict(d.ResolveDict(resources)["XObject"])
+		for _, value := range xobjects {
+			if ref, ok := value.(Ref); ok {
+				if visited[ref] {
+					continue
+				}
+				visited[ref] = true
+			}
+
+			resolved, err := d.Resolve(value)
+			if err != nil {
+				continue
+			}
+			stream, ok := resolved.(*Stream)
+			if !ok {
+				continue
+			}
+
+			switch stream.Dict.Name("Subtype") {
+			case "Image":
+				width, _ := stream.Dict.Int("Width")
+				height, _ := stream.Dict.Int("Height")
+				if area := width * height; area > bestArea {
+					best, bestArea = stream, area
+				}
+			case "Form":
+				scan(stream.Dict["Resources"], depth+1)
+			}
+		}
+	}
+	scan(page["Resources"], 0)
+
+	if best == nil {
+		return nil, ErrNoImage
+	}
+
+	return d.DecodeImage(best)
+}
+
+// DecodeImage decodes an image XObject. JPEG (DCTDecode) images and 8 bit
+// Gray, RGB, CMYK and Indexed images are supported.
+func (d *Document) DecodeImage(stream *Stream) (image.Image, error) {
+	filters, params := d.filters(stream.Dict)
+	data := stream.Raw
+
+	for i, filter := range filters {
+		var err error
+		switch filter {
+		case "DCTDecode", "DCT":
+			if i != len(filters)-1 {
+				return nil, fmt.Errorf("unsupported filter chain")
+			}
+			return decodeJPEG(data)
+		case "FlateDecode", "Fl":
+			data, err = d.flateDecode(data, d.ResolveDict(params[i]))
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		default:
+			return nil, fmt.Errorf("unsupported image filter %s", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d.decodeRawImage(stream.Dict, data)
+}
+
+// decodeJPEG relies on the JPEG markers (JFIF / Adobe) to pick the color transform,
+// they take precedence over the /ColorTransform entry of the PDF
+func decodeJPEG(data []byte) (image.Image, error) {
+	// The header gives the size before anything is allocated for the pixels
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JPEG image: %v", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, fmt.Errorf("invalid image size")
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JPEG image: %v", err)
+	}
+	return img, nil
+}
+
+func (d *Document) decodeRawImage(dict Dict, data []byte) (image.Image, error) {
+	width, _ := dict.Int("Width")
+	height, _ := dict.Int("Height")
+	bpc, _ := dict.Int("BitsPerComponent")
+	if width <= 0 || height <= 0 || width*height > maxImagePixels {
+		return nil, fmt.Errorf("invalid image size")
+	}
+	if bpc != 8 {
+		return nil, fmt.Errorf("unsupported %d bits per component", bpc)
+	}
+
+	components, palette, err := d.colorSpace(dict["ColorSpace"])
+	if err != nil {
+		return nil, err
+	}
+
+	rowSize := int(width) * components
+	if len(data) < rowSize*int(height) {
+		return nil, fmt.Errorf("image data is truncated")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	for y := 0; y < int(height); y++ {
+		row := data[y*rowSize : (y+1)*rowSize]
+		for x := 0; x < int(width); x++ {
+			pixel := row[x*components : (x+1)*components]
+			if palette != nil {
+				img.SetRGBA(x, y, palette[int(pixel[0])%len(palette)])
+				continue
+			}
+			img.SetRGBA(x, y, toRGBA(pixel))
+		}
+	}
+
+	return img, nil
+}
+
+// colorSpace returns the number of components per pixel and, for Indexed color spaces, the palette
+func (d *Document) colorSpace(obj Object) (int, []color.RGBA, error) {
+	resolved, err := d.Resolve(obj)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	switch value := resolved.(type) {
+	case Name:
+		switch value {
+		case "DeviceGray", "G", "CalGray":
+			return 1, nil, nil
+		case "DeviceRGB", "RGB", "CalRGB":
+			return 3, nil, nil
+		case "DeviceCMYK", "CMYK":
+			return 4, nil, nil
+		}
+
+	case Array:
+		if len(value) == 0 {
+			break
+		}
+		family, _ := value[0].(Name)
+		switch family {
+		case "CalGray":
+			return 1, nil, nil
+		case "CalRGB", "Lab":
+			return 3, nil, nil
+		case "ICCBased":
+			if len(value) > 1 {
+				if stream, ok := mustResolve(d, value[1]).(*Stream); ok {
+					if n, ok := stream.Dict.Int("N"); ok && (n == 1 || n == 3 || n == 4) {
+						return int(n), nil, nil
+					}
+				}
+			}
+		case "Indexed", "I":
+			if len(value) < 4 {
+				break
+			}
+			baseComponents, _, err := d.colorSpace(value[1])
+			if err != nil {
+				return 0, nil, err
+			}
+
+			var lookup []byte
+			switch table := mustResolve(d, value[3]).(type) {
+			case String:
+				lookup = table
+			case *Stream:
+				if lookup, err = d.Decode(table); err != nil {
+					return 0, nil, err
+				}
+			}
+
+			var palette []color.RGBA
+			for i := 0; i+baseComponents <= len(lookup); i += baseComponents {
+				palette = append(palette, toRGBA(lookup[i:i+baseComponents]))
+			}
+			if len(palette) == 0 {
+				break
+			}
+			return 1, palette, nil
+		}
+	}
+
+	return 0, nil, fmt.Errorf("unsupported color space")
+}
+
+func mustResolve(d *Document, obj Object) Object {
+	resolved, _ := d.Resolve(obj)
+	return resolved
+}
+
+func toRGBA(pixel []byte) color.RGBA {
+	switch len(pixel) {
+	case 1:
+		return color.RGBA{R: pixel[0], G: pixel[0], B: pixel[0], A: 255}
+	case 3:
+		return color.RGBA{R: pixel[0], G: pixel[1], B: pixel[2], A: 255}
+	case 4:
+		r, g, b := color.CMYKToRGB(pixel[0], pixel[1], pixel[2], pixel[3])
+		return color.RGBA{R: r, G: g, B: b, A: 255}
+	}
+	return color.RGBA{A: 255}
+}
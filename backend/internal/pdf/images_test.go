@@ -0,0 +1,91 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+// imagePDF has a text-only first page and a second page drawing two images, a 4x2 RGB one
+// and, through a form XObject, a 2x2 gray one
+func imagePDF() []byte {
+	rgb := strings.Repeat("\xff\x00\x00", 8)
+	gray := strings.Repeat("\x80", 4)
+	return buildPDF("/Root 1 0 R",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im1 5 0 R /Fm1 6 0 R >> >> >>",
+		fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width 4 /Height 2 /BitsPerComponent 8 /ColorSpace /DeviceRGB /Length %d >>\nstream\n%s\nendstream", len(rgb), rgb),
+		"<< /Type /XObject /Subtype /Form /Resources << /XObject << /Im2 7 0 R >> >> /Length 0 >>\nstream\n\nendstream",
+		fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width 2 /Height 2 /BitsPerComponent 8 /ColorSpace /DeviceGray /Length %d >>\nstream\n%s\nendstream", len(gray), gray),
+	)
+}
+
+func TestLargestImage(t *testing.T) {
+	doc, err := Parse(imagePDF())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want 2", len(pages))
+	}
+
+	if _, err := doc.LargestImage(pages[0]); !errors.Is(err, ErrNoImage) {
+		t.Fatalf("text-only page: got %v, want ErrNoImage", err)
+	}
+
+	img, err := doc.LargestImage(pages[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 2 {
+		t.Fatalf("got a %v image, want the 4x2 one", img.Bounds())
+	}
+	if r, g, b, _ := img.At(0, 0).RGBA(); r>>8 != 0xff || g != 0 || b != 0 {
+		t.Fatalf("pixel = %v, want red", img.At(0, 0))
+	}
+}
+
+func TestDecodeJPEG(t *testing.T) {
+	var small bytes.Buffer
+	if err := jpeg.Encode(&small, image.NewGray(image.Rect(0, 0, 16, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Same file announcing 10000x10000 pixels in its SOF0 header
+	huge := bytes.Clone(small.Bytes())
+	sof := bytes.Index(huge, []byte{0xff, 0xc0})
+	if sof < 0 {
+		t.Fatal("no SOF0 marker")
+	}
+	huge[sof+5], huge[sof+6] = 0x27, 0x10 // height
+	huge[sof+7], huge[sof+8] = 0x27, 0x10 // width
+
+	tests := []struct {
+		name string
+		data []byte
+		ok   bool
+	}{
+		{"small", small.Bytes(), true},
+		{"over the pixel limit", huge, false},
+		{"garbage", []byte("not a jpeg"), false},
+	}
+	for _, test := range tests {
+		img, err := decodeJPEG(test.data)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: error = %v, want ok %v", test.name, err, test.ok)
+		}
+		if err == nil && img.Bounds().Dx() != 16 {
+			t.Errorf("%s: width = %d, want 16", test.name, img.Bounds().Dx())
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package pdf
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokName
+	tokString
+	tokKeyword
+	tokArrayOpen
+	tokArrayClose
+	tokDictOpen
+	tokDictClose
+)
+
+type token struct {
+	kind    tokenKind
+	text    string
+	str     []byte
+	isInt   bool
+	intVal  int64
+	realVal float64
+}
+
+// lexer splits the raw bytes of a PDF file into tokens
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhitespace(b byte) bool {
+	switch b {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		if isWhitespace(b) {
+			l.pos++
+			continue
+		}
+		if b == '%' {
+			// Comments run until the end of the line
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return token{kind: tokEOF}, nil
+	}
+
+	b := l.data[l.pos]
+	switch {
+	case b == '[':
+		l.pos++
+		return token{kind: tokArrayOpen}, nil
+	case b == ']':
+		l.pos++
+		return token{kind: tokArrayClose}, nil
+	case b == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return token{kind: tokDictOpen}, nil
+		}
+		return l.hexString()
+	case b == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return token{kind: tokDictClose}, nil
+		}
+		return token{}, fmt.Errorf("unexpected '>' at offset %d", l.pos)
+	case b == '(':
+		return l.literalString()
+	case b == ')':
+		return token{}, fmt.Errorf("unexpected ')' at offset %d", l.pos)
+	case b == '/':
+		return l.name(), nil
+	case b == '+' || b == '-' || b == '.' || isDigit(b):
+		return l.number(), nil
+	case b == '{' || b == '}':
+		l.pos++
+		return token{kind: tokKeyword, text: string(b)}, nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return token{kind: tokKeyword, text: string(l.data[start:l.pos])}, nil
+}
+
+func (l *lexer) number() token {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) && (isDigit(l.data[l.pos]) || l.data[l.pos] == '.') {
+		l.pos++
+	}
+	text := string(l.data[start:l.pos])
+
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return token{kind: tokNumber, text: text, isInt: true, intVal: value}
+	}
+
+	// Malformed numbers (e.g. "--1" or "1.2.3") are read as zero like most viewers do
+	value, _ := strconv.ParseFloat(text, 64)
+	return token{kind: tokNumber, text: text, realVal: value}
+}
+
+func (l *lexer) name() token {
+	l.pos++ // skip '/'
+	var name []byte
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		b := l.data[l.pos]
+		// #xx is the hex escape of a byte inside a name
+		if b == '#' && l.pos+2 < len(l.data) {
+			if value, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				name = append(name, byte(value))
+				l.pos += 3
+				continue
+			}
+		}
+		name = append(name, b)
+		l.pos++
+	}
+	return token{kind: tokName, text: string(name)}
+}
+
+func (l *lexer) literalString() (token, error) {
+	start := l.pos
+	l.pos++ // skip '('
+	depth := 1
+	var str []byte
+
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return token{kind: tokString, str: str}, nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				continue
+			}
+			esc := l.data[l.pos]
+			l.pos++
+			switch esc {
+			case 'n':
+				str = append(str, '\n')
+			case 'r':
+				str = append(str, '\r')
+			case 't':
+				str = append(str, '\t')
+			case 'b':
+				str = append(str, '\b')
+			case 'f':
+				str = append(str, '\f')
+			case '\r':
+				// Line continuation, also swallow the LF of a CRLF
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+				// Line continuation
+			default:
+				if esc >= '0' && esc <= '7' {
+					value := int(esc - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					str = append(str, byte(value))
+				} else {
+					str = append(str, esc)
+				}
+			}
+			continue
+		}
+		str = append(str, b)
+	}
+
+	return token{}, fmt.Errorf("unterminated string starting at offset %d", start)
+}
+
+func (l *lexer) hexString() (token, error) {
+	start := l.pos
+	l.pos++ // skip '<'
+	var str []byte
+	var digits []byte
+
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+		if b == '>' {
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			for i := 0; i < len(digits); i += 2 {
+				value, _ := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+				str = append(str, byte(value))
+			}
+			return token{kind: tokString, str: str}, nil
+		}
+		if isWhitespace(b) {
+			continue
+		}
+		if !isHexDigit(b) {
+			return token{}, fmt.Errorf("invalid hex string starting at offset %d", start)
+		}
+		digits = append(digits, b)
+	}
+
+	return token{}, fmt.Errorf("unterminated hex string starting at offset %d", start)
+}
+
+func isHexDigit(b byte) bool {
+	return isDigit(b) || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
@@ -0,0 +1,157 @@
+package pdf
+
+import (
+	"fmt"
+)
+
+// Object is any PDF object: nil, bool, int64, float64, Name, String, Array, Dict, Ref or *Stream
+type Object interface{}
+
+// Name is a PDF name object, without the leading slash
+type Name string
+
+// String is a PDF string object holding the raw decoded bytes
+type String []byte
+
+// Array is a PDF array object
+type Array []Object
+
+// Dict is a PDF dictionary object
+type Dict map[Name]Object
+
+// Ref is an indirect reference to an object of the document
+type Ref struct {
+	Num int
+	Gen int
+}
+
+// Stream is a PDF stream object. Raw holds the data as stored in the file, still encoded.
+type Stream struct {
+	Dict Dict
+	Raw  []byte
+}
+
+// maxDepth limits nesting of arrays and dictionaries to protect against crafted files
+const maxDepth = 64
+
+type parser struct {
+	lex   *lexer
+	depth int
+}
+
+func (p *parser) parseObject() (Object, error) {
+	tok, err := p.lex.next()
+	if err != nil {
+		return nil, err
+	}
+	return p.parseFrom(tok)
+}
+
+func (p *parser) parseFrom(tok token) (Object, error) {
+	switch tok.kind {
+	case tokEOF:
+		return nil, fmt.Errorf("unexpected end of file")
+
+	case tokNumber:
+		if !tok.isInt {
+			return tok.realVal, nil
+		}
+
+		// An integer may be the start of an indirect reference "num gen R"
+		save := p.lex.pos
+		gen, err := p.lex.next()
+		if err == nil && gen.kind == tokNumber && gen.isInt {
+			r, err := p.lex.next()
+			if err == nil && r.kind == tokKeyword && r.text == "R" {
+				return Ref{Num: int(tok.intVal), Gen: int(gen.intVal)}, nil
+			}
+		}
+		p.lex.pos = save
+		return tok.intVal, nil
+
+	case tokName:
+		return Name(tok.text), nil
+
+	case tokString:
+		return String(tok.str), nil
+
+	case tokArrayOpen:
+		if p.depth >= maxDepth {
+			return nil, fmt.Errorf("objects nested too deeply")
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+
+		array := Array{}
+		for {
+			next, err := p.lex.next()
+			if err != nil {
+				return nil, err
+			}
+			if next.kind == tokArrayClose {
+				return array, nil
+			}
+			item, err := p.parseFrom(next)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+
+	case tokDictOpen:
+		if p.depth >= maxDepth {
+			return nil, fmt.Errorf("objects nested too deeply")
+		}
+		p.depth++
+		defer func() { p.depth-- }()
+
+		dict := Dict{}
+		for {
+			key, err := p.lex.next()
+			if err != nil {
+				return nil, err
+			}
+			if key.kind == tokDictClose {
+				return dict, nil
+			}
+			if key.kind != tokName {
+				return nil, fmt.Errorf("dictionary key is not a name at offset %d", p.lex.pos)
+			}
+			value, err := p.parseObject()
+			if err != nil {
+				return nil, err
+			}
+			dict[Name(key.text)] = value
+		}
+
+	case tokKeyword:
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unexpected keyword %q at offset %d", tok.text, p.lex.pos)
+	}
+
+	return nil, fmt.Errorf("unexpected token at offset %d", p.lex.pos)
+}
+
+// Helpers to read typed values out of dictionaries
+
+func (d Dict) Name(key Name) Name {
+	name, _ := d[key].(Name)
+	return name
+}
+
+func (d Dict) Int(key Name) (int64, bool) {
+	switch value := d[key].(type) {
+	case int64:
+		return value, true
+	case float64:
+		return int64(value), true
+	}
+	return 0, false
+}
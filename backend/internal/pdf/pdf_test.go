@@ -0,0 +1,260 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF numbers the objects from 1 and writes a classic cross-reference table
+func buildPDF(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+
+	offsets := []int{}
+	for i, body := range objects {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return b.Bytes()
+}
+
+// buildObjStmPDF stores the objects, numbered from 1, in a compressed object stream
+// and indexes them with a cross-reference stream
+func buildObjStmPDF(objects ...string) []byte {
+	var header, body bytes.Buffer
+	for i, object := range objects {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(object + "\n")
+	}
+	content := append(header.Bytes(), body.Bytes()...)
+
+	objStmNum := len(objects) + 1
+	xrefNum := len(objects) + 2
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	objStmOffset := b.Len()
+	compressed := deflate(content)
+	fmt.Fprintf(&b, "%d 0 obj\n<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n",
+		objStmNum, len(objects), header.Len(), len(compressed))
+	b.Write(compressed)
+	b.WriteString("\nendstream\nendobj\n")
+
+	// W [1 4 2]: type, offset or object stream number, generation or index
+	xrefOffset := b.Len()
+	var entries bytes.Buffer
+	entry := func(kind byte, field1 uint32, field2 uint16) {
+		entries.WriteByte(kind)
+		binary.Write(&entries, binary.BigEndian, field1)
+		binary.Write(&entries, binary.BigEndian, field2)
+	}
+	entry(0, 0, 65535)
+	for i := range objects {
+		entry(2, uint32(objStmNum), uint16(i))
+	}
+	entry(1, uint32(objStmOffset), 0)
+	entry(1, uint32(xrefOffset), 0)
+
+	fmt.Fprintf(&b, "%d 0 obj\n<< /Type /XRef /Size %d /W [1 4 2] /Root 1 0 R /Length %d >>\nstream\n",
+		xrefNum, xrefNum+1, entries.Len())
+	b.Write(entries.Bytes())
+	fmt.Fprintf(&b, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	return b.Bytes()
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	writer := zlib.NewWriter(&b)
+	writer.Write(data)
+	writer.Close()
+	return b.Bytes()
+}
+
+const (
+	testCatalog = "<< /Type /Catalog /Pages 2 0 R >>"
+	testPages   = "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"
+	testPage    = "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		rule string // empty when the file is valid
+	}{
+		{"minimal", buildPDF("/Root 1 0 R", testCatalog, testPages, testPage), ""},
+		{"object stream", buildObjStmPDF(testCatalog, testPages, testPage), ""},
+		{"not a pdf", []byte("hello"), RuleStructure},
+		{"truncated", buildPDF("/Root 1 0 R", testCatalog, testPages, testPage)[:60], RuleStructure},
+		{"no pages", buildPDF("/Root 1 0 R", testCatalog, "<< /Type /Pages /Kids [] /Count 0 >>"), RuleNoPages},
+		{"encrypted", buildPDF("/Root 1 0 R /Encrypt << /Filter /Standard >>", testCatalog, testPages, testPage), RuleEncrypted},
+		{
+			"javascript open action",
+			buildPDF("/Root 1 0 R", "<< /Type /Catalog /Pages 2 0 R /OpenAction 4 0 R >>", testPages, testPage,
+				"<< /S /JavaScript /JS (app.alert(1)) >>"),
+			RuleAutoAction,
+		},
+		{
+			"javascript link",
+			buildPDF("/Root 1 0 R", testCatalog, testPages, "<< /Type /Page /Parent 2 0 R /Annots [4 0 R] >>",
+				"<< /Type /Annot /Subtype /Link /A << /S /JavaScript /JS (app.alert(1)) >> >>"),
+			RuleJavaScript,
+		},
+		{
+			"goto open action",
+			buildPDF("/Root 1 0 R", "<< /Type /Catalog /Pages 2 0 R /OpenAction << /S /GoTo /D [3 0 R /Fit] >> >>", testPages, testPage),
+			"",
+		},
+		{
+			"uri open action",
+			buildPDF("/Root 1 0 R", "<< /Type /Catalog /Pages 2 0 R /OpenAction << /S /URI /URI (https://example.com) >> >>", testPages, testPage),
+			RuleAutoAction,
+		},
+		{
+			"launch action",
+			buildPDF("/Root 1 0 R", testCatalog, testPages, "<< /Type /Page /Parent 2 0 R /Annots [<< /A << /S /Launch /F (calc.exe) >> >>] >>"),
+			RuleLaunch,
+		},
+		{
+			"embedded file",
+			buildPDF("/Root 1 0 R", "<< /Type /Catalog /Pages 2 0 R /Names << /EmbeddedFiles << /Names [] >> >> >>", testPages, testPage),
+			RuleEmbeddedFile,
+		},
+		{
+			"page automatic action",
+			buildPDF("/Root 1 0 R", testCatalog, testPages, "<< /Type /Page /Parent 2 0 R /AA << /O << /S /GoTo >> >> >>"),
+			RuleAutoAction,
+		},
+		{
+			"javascript in object stream",
+			buildObjStmPDF(testCatalog, testPages, testPage, "<< /S /JavaScript /JS (x) >>"),
+			RuleJavaScript,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			info, err := Validate(test.data)
+			if test.rule == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				if info.PageCount != 1 {
+					t.Fatalf("PageCount = %d, want 1", info.PageCount)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Validate error = %v, want rule %s", err, test.rule)
+			}
+			if validationErr.Rule != test.rule {
+				t.Fatalf("Validate rule = %s (%v), want %s", validationErr.Rule, err, test.rule)
+			}
+		})
+	}
+}
+
+func TestValidateInfo(t *testing.T) {
+	data := buildPDF("/Root 1 0 R /Info 4 0 R", testCatalog, testPages, testPage,
+		"<< /Title (Curriculum) /Author <FEFF004A0061006E0065> /CreationDate (D:20250131094500+01'00') >>")
+	info, err := Validate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "1.4" || info.Title != "Curriculum" || info.Author != "Jane" {
+		t.Fatalf("Info = %+v", info)
+	}
+	if info.CreationDate == nil || info.CreationDate.UTC().Format("2006-01-02T15:04") != "2025-01-31T08:45" {
+		t.Fatalf("CreationDate = %v", info.CreationDate)
+	}
+}
+
+func TestObjectStreamDecodedOnce(t *testing.T) {
+	objects := []string{testCatalog, testPages, testPage}
+	for i := 0; i < 500; i++ {
+		objects = append(objects, fmt.Sprintf("<< /Padding (%s) >>", strings.Repeat("x", 200)))
+	}
+	doc, err := Parse(buildObjStmPDF(objects...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, num := range doc.ObjectNumbers() {
+		if _, err := doc.Object(num); err != nil {
+			t.Fatalf("object %d: %v", num, err)
+		}
+	}
+
+	// The object stream is inflated once, not once per object
+	stream, err := doc.Object(len(objects) + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := (&Document{cache: map[int]Object{}, resolving: map[int]bool{}}).Decode(stream.(*Stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.decoded != int64(len(content)) {
+		t.Fatalf("decoded %d bytes, want %d", doc.decoded, len(content))
+	}
+}
+
+func TestDocumentDecodeBudget(t *testing.T) {
+	doc, err := Parse(buildPDF("/Root 1 0 R", testCatalog, testPages, testPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := &Stream{Dict: Dict{"Filter": Name("FlateDecode")}, Raw: deflate(make([]byte, 1024))}
+
+	if _, err := doc.Decode(stream); err != nil {
+		t.Fatalf("Decode within the budget: %v", err)
+	}
+
+	doc.decoded = maxDocumentDecodedSize - 100
+	if _, err := doc.Decode(stream); err == nil {
+		t.Fatal("Decode past the document budget succeeded")
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"D:20250131094500+01'00'", "2025-01-31T08:45:00Z"},
+		{"D:20250131094500Z", "2025-01-31T09:45:00Z"},
+		{"D:2025", "2025-01-01T00:00:00Z"},
+		{"20250131", "2025-01-31T00:00:00Z"},
+		{"D:20250131094500-05'30'", "2025-01-31T15:15:00Z"},
+	}
+	for _, test := range tests {
+		date, err := ParseDate(test.value)
+		if err != nil {
+			t.Errorf("ParseDate(%q): %v", test.value, err)
+			continue
+		}
+		if got := date.UTC().Format("2006-01-02T15:04:05Z"); got != test.want {
+			t.Errorf("ParseDate(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+
+	for _, value := range []string{"", "D:", "D:20x"} {
+		if _, err := ParseDate(value); err == nil {
+			t.Errorf("ParseDate(%q) succeeded", value)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package pdf
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Rules checked by Validate, returned in ValidationError.Rule
+const (
+	RuleStructure    = "structure"
+	RuleEncrypted    = "encrypted"
+	RuleJavaScript   = "javascript"
+	RuleLaunch       = "launch_action"
+	RuleEmbeddedFile = "embedded_file"
+	RuleAutoAction   = "auto_action"
+	RuleNoPages      = "no_pages"
+)
+
+// ValidationError reports the rule that rejected the file
+type ValidationError struct {
+	Rule    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Info is the metadata extracted from a valid PDF
+type Info struct {
+	Version      string
+	PageCount    int
+	Title        string
+	Author       string
+	CreationDate *time.Time
+}
+
+// Validate parses the whole document and rejects encrypted files and files containing
+// active content (JavaScript, launch actions, embedded files, automatic actions).
+// On success it returns the page count and the document metadata.
+func Validate(data []byte) (*Info, error) {
+	doc, err := Parse(data)
+	if err != nil {
+		return nil, &ValidationError{Rule: RuleStructure, Message: "Invalid PDF structure: " + err.Error()}
+	}
+
+	if _, ok := doc.Trailer["Encrypt"]; ok {
+		return nil, &ValidationError{Rule: RuleEncrypted, Message: "Encrypted or password protected PDF files are not allowed"}
+	}
+
+	// Every object listed in the xref must parse, then it is checked for active content
+	nums := doc.ObjectNumbers()
+	sort.Ints(nums)
+	for _, num := range nums {
+		obj, err := doc.Object(num)
+		if err != nil {
+			return nil, &ValidationError{Rule: RuleStructure, Message: "Invalid PDF structure: " + err.Error()}
+		}
+		if err := checkActiveContent(doc, obj, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	root := doc.ResolveDict(doc.Trailer["Root"])
+	if root == nil {
+		return nil, &ValidationError{Rule: RuleStructure, Message: "Invalid PDF structure: missing document catalog"}
+	}
+
+	pages := doc.ResolveDict(root["Pages"])
+	count, ok := pages.Int("Count")
+	if pages == nil || !ok {
+		return nil, &ValidationError{Rule: RuleStructure, Message: "Invalid PDF structure: missing page tree"}
+	}
+	if count <= 0 {
+		return nil, &ValidationError{Rule: RuleNoPages, Message: "The PDF file has no pages"}
+	}
+
+	info := &Info{
+		Version:   doc.Version,
+		PageCount: int(count),
+	}
+
+	if metadata := doc.ResolveDict(doc.Trailer["Info"]); metadata != nil {
+		title, _ := doc.Resolve(metadata["Title"])
+		author, _ := doc.Resolve(metadata["Author"])
+		creationDate, _ := doc.Resolve(metadata["CreationDate"])
+
+		info.Title = TextString(title)
+		info.Author = TextString(author)
+		if date, err := ParseDate(TextString(creationDate)); err == nil {
+			info.CreationDate = &date
+		}
+	}
+
+	return info, nil
+}
+
+func checkActiveContent(doc *Document, obj Object, depth int) error {
+	if depth > maxDepth {
+		return nil
+	}
+
+	switch value := obj.(type) {
+	case *Stream:
+		return checkActiveContent(doc, value.Dict, depth+1)
+
+	case Array:
+		for _, item := range value {
+			if err := checkActiveContent(doc, item, depth+1); err != nil {
+				return err
+			}
+		}
+
+	case Dict:
+		// Sorted keys so the reported rule does not depend on map order
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, string(key))
+		}
+		sort.Strings(keys)
+
+		for _, keyString := range keys {
+			key, item := Name(keyString), value[Name(keyString)]
+			switch key {
+			case "JavaScript", "JS":
+				return &ValidationError{Rule: RuleJavaScript, Message: "PDF files containing JavaScript are not allowed"}
+			case "Launch":
+				return &ValidationError{Rule: RuleLaunch, Message: "PDF files containing launch actions are not allowed"}
+			case "EmbeddedFiles", "EmbeddedFile", "EF":
+				return &ValidationError{Rule: RuleEmbeddedFile, Message: "PDF files containing embedded files are not allowed"}
+			case "AA":
+				return &ValidationError{Rule: RuleAutoAction, Message: "PDF files containing automatic actions are not allowed"}
+			case "OpenAction":
+				// A destination or a plain GoTo action only sets the initial view, any other action runs on open
+				if action := doc.ResolveDict(item); action != nil {
+					if action.Name("S") != "GoTo" || action["Next"] != nil {
+						return &ValidationError{Rule: RuleAutoAction, Message: "PDF files containing automatic actions are not allowed"}
+					}
+				}
+			case "S", "Type", "Subtype":
+				switch item {
+				case Name("JavaScript"):
+					return &ValidationError{Rule: RuleJavaScript, Message: "PDF files containing JavaScript are not allowed"}
+				case Name("Launch"):
+					return &ValidationError{Rule: RuleLaunch, Message: "PDF files containing launch actions are not allowed"}
+				case Name("EmbeddedFile"), Name("FileAttachment"):
+					return &ValidationError{Rule: RuleEmbeddedFile, Message: "PDF files containing embedded files are not allowed"}
+				}
+			}
+
+			if err := checkActiveContent(doc, item, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ParseDate parses a PDF date string like "D:20250131094500+01'00'".
+// Every part after the year is optional.
+func ParseDate(value string) (time.Time, error) {
+	if len(value) >= 2 && value[:2] == "D:" {
+		value = value[2:]
+	}
+	if len(value) < 4 {
+		return time.Time{}, fmt.Errorf("invalid date %q", value)
+	}
+
+	// year, month, day, hour, minute, second
+	parts := []int{0, 1, 1, 0, 0, 0}
+	widths := []int{4, 2, 2, 2, 2, 2}
+	pos := 0
+	for i, width := range widths {
+		if pos+width > len(value) || !isDigit(value[pos]) {
+			break
+		}
+		number, err := strconv.Atoi(value[pos : pos+width])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date %q", value)
+		}
+		parts[i] = number
+		pos += width
+	}
+
+	location := time.UTC
+	if pos < len(value) && (value[pos] == '+' || value[pos] == '-') {
+		sign := 1
+		if value[pos] == '-' {
+			sign = -1
+		}
+		var hours, minutes int
+		if pos+3 <= len(value) {
+			hours, _ = strconv.Atoi(value[pos+1 : pos+3])
+		}
+		if pos+6 <= len(value) && value[pos+3] == '\'' {
+			minutes, _ = strconv.Atoi(value[pos+4 : pos+6])
+		}
+		location = time.FixedZone("", sign*(hours*3600+minutes*60))
+	}
+
+	return time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], 0, location), nil
+}
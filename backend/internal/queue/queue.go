@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PushTimeout is how long Push waits for room in a full queue before dropping the item
+const PushTimeout = time.Second
+
+// saturationRatio is the fill ratio from which Check reports the queue as saturated
+const saturationRatio = 0.9
+
+// Queue hands items to a background goroutine writing them one at a time, in order.
+// It is bounded: requests pushing to a full queue wait for the writer, up to PushTimeout.
+type Queue[T any] struct {
+	name    string
+	items   chan T
+	write   func(T)
+	mu      sync.RWMutex
+	closed  bool
+	stopped chan struct{}
+}
+
+// Start creates a queue of size items and starts its writer
+func Start[T any](name string, size int, write func(T)) *Queue[T] {
+	q := &Queue[T]{
+		name:    name,
+		items:   make(chan T, size),
+		write:   write,
+		stopped: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(q.stopped)
+		for item := range q.items {
+			q.write(item)
+		}
+	}()
+
+	return q
+}
+
+// Push queues the item. It returns false, after logging it, if the item was dropped
+// because the queue stayed full or is stopped.
+func (q *Queue[T]) Push(item T) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		fmt.Println("Dropping", q.name, "item, the queue is stopped")
+		return false
+	}
+
+	select {
+	case q.items <- item:
+		return true
+	default:
+	}
+
+	timer := time.NewTimer(PushTimeout)
+	defer timer.Stop()
+	select {
+	case q.items <- item:
+		return true
+	case <-timer.C:
+		fmt.Println("Dropping", q.name, "item, the queue is full")
+		return false
+	}
+}
+
+// Stop refuses new items and returns once the queued ones are written
+func (q *Queue[T]) Stop() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.items)
+	}
+	q.mu.Unlock()
+
+	<-q.stopped
+}
+
+// Check returns an error when the queue is nearly full, the writer does not keep up.
+// It is a readiness check.
+func (q *Queue[T]) Check(ctx context.Context) error {
+	if queued, size := len(q.items), cap(q.items); float64(queued) >= saturationRatio*float64(size) {
+		return fmt.Errorf("%s queue saturated: %d of %d items", q.name, queued, size)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueWritesInOrderAndDrainsOnStop(t *testing.T) {
+	var mu sync.Mutex
+	written := []int{}
+	q := Start("test", 100, func(item int) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		written = append(written, item)
+		mu.Unlock()
+	})
+
+	for i := 0; i < 50; i++ {
+		if !q.Push(i) {
+			t.Fatalf("Push(%d) dropped", i)
+		}
+	}
+	q.Stop()
+
+	if len(written) != 50 {
+		t.Fatalf("wrote %d items before Stop returned, want 50", len(written))
+	}
+	for i, item := range written {
+		if item != i {
+			t.Fatalf("item %d = %d, items must be written in order", i, item)
+		}
+	}
+
+	if q.Push(50) {
+		t.Fatal("Push after Stop accepted the item")
+	}
+	q.Stop() // stopping twice is harmless
+}
+
+func TestQueueSaturation(t *testing.T) {
+	taken := make(chan struct{}, 1)
+	release := make(chan struct{})
+	q := Start("test", 10, func(int) {
+		select {
+		case taken <- struct{}{}:
+		default:
+		}
+		<-release
+	})
+	defer q.Stop()
+	defer close(release)
+
+	// The writer holds the first item, the next ones fill the queue
+	q.Push(0)
+	<-taken
+	for i := 1; i <= 8; i++ {
+		q.Push(i)
+	}
+	if err := q.Check(context.Background()); err != nil {
+		t.Fatalf("Check with 8 of 10 items: %v", err)
+	}
+
+	q.Push(9)
+	if err := q.Check(context.Background()); err == nil {
+		t.Fatal("Check with 9 of 10 items, want saturated")
+	}
+
+	q.Push(10)
+	start := time.Now()
+	if q.Push(11) {
+		t.Fatal("Push to a full queue accepted the item")
+	}
+	if waited := time.Since(start); waited < PushTimeout {
+		t.Fatalf("Push gave up after %v, want %v", waited, PushTimeout)
+	}
+}
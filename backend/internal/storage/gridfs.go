@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"backend/mongodb"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultGridFSBucket is used when STORAGE_GRIDFS_BUCKET is not set
+const DefaultGridFSBucket = "uploads"
+
+// GridFSStore keeps blobs in a MongoDB GridFS bucket of the application database
+type GridFSStore struct {
+	bucket *gridfs.Bucket
+}
+
+type gridFSMetadata struct {
+	ContentType string `bson:"contentType"`
+}
+
+// NewGridFSStore opens the bucket on the database configured with DB_NAME.
+// MongoDB must be initialized before calling it.
+func NewGridFSStore(bucketName string) (*GridFSStore, error) {
+	if bucketName == "" {
+		bucketName = DefaultGridFSBucket
+	}
+
+	db := mongodb.GetDatabase(mongodb.DatabaseName)
+	bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName(bucketName))
+	if err != nil {
+		return nil, fmt.Errorf("could not open GridFS bucket: %v", err)
+	}
+
+	return &GridFSStore{bucket: bucket}, nil
+}
+
+func (s *GridFSStore) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	// Keep the previous revisions so they can be removed once the new one is complete
+	previous, err := s.revisions(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// The driver has no context for uploads, the stream is aborted when ctx is done and
+	// its deadline bounds the chunk writes
+	uploadOpts := options.GridFSUpload().SetMetadata(gridFSMetadata{ContentType: contentType})
+	stream, err := s.bucket.OpenUploadStream(name, uploadOpts)
+	if err != nil {
+		return fmt.Errorf("could not upload to GridFS: %v", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		stream.SetWriteDeadline(deadline)
+	}
+	if _, err := io.Copy(stream, contextReader{ctx: ctx, r: r}); err != nil {
+		stream.Abort()
+		return fmt.Errorf("could not upload to GridFS: %v", err)
+	}
+	if err := stream.Close(); err != nil {
+		return fmt.Errorf("could not upload to GridFS: %v", err)
+	}
+
+	for _, file := range previous {
+		if err := s.bucket.DeleteContext(ctx, file.ID); err != nil && err != gridfs.ErrFileNotFound {
+			return fmt.Errorf("could not delete previous revision: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *GridFSStore) Get(ctx context.Context, name string) (io.ReadCloser, *BlobInfo, error) {
+	stream, err := s.bucket.OpenDownloadStreamByName(name)
+	if err != nil {
+		if err == gridfs.ErrFileNotFound {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, fmt.Errorf("could not open GridFS file: %v", err)
+	}
+
+	return stream, gridFSBlobInfo(stream.GetFile()), nil
+}
+
+func (s *GridFSStore) Stat(ctx context.Context, name string) (*BlobInfo, error) {
+	// Latest revision only, like OpenDownloadStreamByName
+	findOpts := options.GridFSFind().SetSort(bson.D{{Key: "uploadDate", Value: -1}}).SetLimit(1)
+	cursor, err := s.bucket.FindContext(ctx, bson.M{"filename": name}, findOpts)
+	if err != nil {
+		return nil, fmt.Errorf("could not find GridFS file: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	if !cursor.Next(ctx) {
+		if err := cursor.Err(); err != nil {
+			return nil, fmt.Errorf("could not find GridFS file: %v", err)
+		}
+		return nil, ErrNotFound
+	}
+
+	var file gridfs.File
+	if err := cursor.Decode(&file); err != nil {
+		return nil, fmt.Errorf("could not decode GridFS file: %v", err)
+	}
+
+	return gridFSBlobInfo(&file), nil
+}
+
+func (s *GridFSStore) Delete(ctx context.Context, name string) error {
+	files, err := s.revisions(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := s.bucket.DeleteContext(ctx, file.ID); err != nil && err != gridfs.ErrFileNotFound {
+			return fmt.Errorf("could not delete GridFS file: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *GridFSStore) revisions(ctx context.Context, name string) ([]gridfs.File, error) {
+	cursor, err := s.bucket.FindContext(ctx, bson.M{"filename": name})
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not list GridFS revisions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var files []gridfs.File
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("could not decode GridFS revisions: %v", err)
+	}
+
+	return files, nil
+}
+
+// contextReader fails the reads once the context is done, stopping the copy of an upload
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func gridFSBlobInfo(file *gridfs.File) *BlobInfo {
+	info := &BlobInfo{
+		Name:    file.Name,
+		Size:    file.Length,
+		ModTime: file.UploadDate,
+	}
+
+	var metadata gridFSMetadata
+	if file.Metadata != nil && bson.Unmarshal(file.Metadata, &metadata) == nil {
+		info.ContentType = metadata.ContentType
+	}
+
+	return info
+}
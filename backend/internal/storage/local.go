@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// DefaultLocalDirectory is used when STORAGE_LOCAL_DIR is not set
+const DefaultLocalDirectory = "./uploads"
+
+// LocalStore keeps blobs as plain files inside a directory on the local disk
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates the directory if needed and returns a store rooted in it
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if dir == "" {
+		dir = DefaultLocalDirectory
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create storage directory: %v", err)
+	}
+
+	return &LocalStore{dir: dir}, nil
+}
+
+func (s *LocalStore) path(name string) (string, error) {
+	// Reject names that would escape the storage directory
+	clean := filepath.Clean(name)
+	if clean != filepath.Base(clean) || clean == "." || clean == ".." {
+		return "", fmt.Errorf("invalid blob name %q", name)
+	}
+	return filepath.Join(s.dir, clean), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	dstPath, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see a partial upload
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("could not create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write file: %v", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not close file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), dstPath); err != nil {
+		return fmt.Errorf("could not move file into place: %v", err)
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, name string) (io.ReadCloser, *BlobInfo, error) {
+	filePath, err := s.path(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, ErrNotFound
+		}
+		return nil, nil, fmt.Errorf("could not open file: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("could not stat file: %v", err)
+	}
+
+	return file, localBlobInfo(name, info), nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, name string) (*BlobInfo, error) {
+	filePath, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("could not stat file: %v", err)
+	}
+
+	return localBlobInfo(name, info), nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, name string) error {
+	filePath, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not delete file: %v", err)
+	}
+
+	return nil
+}
+
+// CheckWritable creates and removes a file in the directory, uploads fail when it cannot
+func (s *LocalStore) CheckWritable() error {
+	tmp, err := os.CreateTemp(s.dir, ".ready-*")
+	if err != nil {
+		return fmt.Errorf("storage directory is not writable: %v", err)
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	return nil
+}
+
+func localBlobInfo(name string, info os.FileInfo) *BlobInfo {
+	return &BlobInfo{
+		Name:        name,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(name)),
+		ModTime:     info.ModTime(),
+	}
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(filepath.Join(t.TempDir(), "uploads"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+
+	// No temporary file is left behind by the uploads
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("storage directory not empty after Delete: %v", entries)
+	}
+}
+
+func TestLocalStoreRejectsEscapingNames(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"cv.pdf", true},
+		{"cv-preview.png", true},
+		{"../cv.pdf", false},
+		{"../../etc/passwd", false},
+		{"dir/cv.pdf", false},
+		{"/etc/passwd", false},
+		{".", false},
+		{"..", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		err := store.Put(context.Background(), test.name, strings.NewReader("x"), 1, "")
+		if (err == nil) != test.ok {
+			t.Errorf("Put(%q) error = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestLocalStoreCheckWritable(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CheckWritable(); err != nil {
+		t.Fatalf("CheckWritable: %v", err)
+	}
+
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+	if err := store.CheckWritable(); err == nil {
+		t.Fatal("CheckWritable succeeded on a read-only directory")
+	}
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config holds the connection settings of an S3-compatible service (AWS S3, MinIO, ...)
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses objects as endpoint/bucket/key instead of bucket.endpoint/key,
+	// which is what MinIO and most self-hosted services expect
+	PathStyle bool
+}
+
+// S3Store keeps blobs in a bucket of an S3-compatible object storage.
+// Requests are signed with AWS Signature Version 4.
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Store validates the configuration and returns a store for the bucket
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("S3_ACCESS_KEY and S3_SECRET_KEY are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", config.Endpoint)
+	}
+
+	return &S3Store{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error {
+	// The payload hash is part of the signature, so the body is buffered.
+	// Uploads are small (see handlers.MaxFileSize).
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("could not read upload: %v", err)
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, name, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, name string) (io.ReadCloser, *BlobInfo, error) {
+	resp, err := s.do(ctx, http.MethodGet, name, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, nil, s3Error(resp)
+	}
+
+	return resp.Body, s3BlobInfo(name, resp), nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, name string) (*BlobInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, name, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp)
+	}
+
+	return s3BlobInfo(name, resp), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, name, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// S3 answers 204 even when the object does not exist
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+
+	return nil
+}
+
+func (s *S3Store) objectURL(name string) *url.URL {
+	u := *s.endpoint
+	key := "/" + strings.TrimPrefix(name, "/")
+	if s.config.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.config.Bucket + key
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + key
+	}
+	return &u
+}
+
+func (s *S3Store) do(ctx context.Context, method, name string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(name).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not create S3 request: %v", err)
+	}
+	req.ContentLength = int64(len(body))
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 request failed: %v", err)
+	}
+
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 authorization headers to the request
+func (s *S3Store) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	shortDate := now.Format("20060102")
+
+	payloadHash := sha256.Sum256(body)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+
+	// Canonical headers, lower-case and sorted
+	var signedHeaders []string
+	canonicalValues := map[string]string{}
+	for key, values := range req.Header {
+		lower := strings.ToLower(key)
+		signedHeaders = append(signedHeaders, lower)
+		canonicalValues[lower] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	sort.Strings(signedHeaders)
+
+	var canonicalHeaders strings.Builder
+	for _, key := range signedHeaders {
+		canonicalHeaders.WriteString(key + ":" + canonicalValues[key] + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHex,
+	}, "\n")
+
+	scope := shortDate + "/" + s.config.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.config.SecretKey), shortDate)
+	signingKey = hmacSHA256(signingKey, s.config.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, strings.Join(signedHeaders, ";"), signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3BlobInfo(name string, resp *http.Response) *BlobInfo {
+	info := &BlobInfo{
+		Name:        name,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.ModTime = modTime
+	}
+
+	return info
+}
+
+func s3Error(resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+}
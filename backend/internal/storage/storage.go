@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"backend/internal/config"
+)
+
+// ErrNotFound is returned when the requested blob does not exist in the store
+var ErrNotFound = errors.New("blob not found")
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Name        string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// BlobStore is the interface implemented by every storage backend used for uploaded files
+type BlobStore interface {
+	// Put stores the content read from r under name, replacing any previous blob with the same name
+	Put(ctx context.Context, name string, r io.Reader, size int64, contentType string) error
+	// Get returns a reader for the blob and its info. The caller must close the reader.
+	Get(ctx context.Context, name string) (io.ReadCloser, *BlobInfo, error)
+	// Stat returns the info of the blob without reading its content
+	Stat(ctx context.Context, name string) (*BlobInfo, error)
+	// Delete removes the blob, it is not an error if the blob does not exist
+	Delete(ctx context.Context, name string) error
+}
+
+// Global variable to hold the storage backend selected on startup
+var Store BlobStore
+
+// CheckWritable returns an error if uploads cannot be stored. Only the local directory is
+// checked, GridFS is covered by the database ping and S3 is not probed.
+func CheckWritable() error {
+	if Store == nil {
+		return fmt.Errorf("blob storage is not initialized")
+	}
+	if local, ok := Store.(*LocalStore); ok {
+		return local.CheckWritable()
+	}
+	return nil
+}
+
+// InitStorage selects the blob storage backend of STORAGE_BACKEND.
+// Supported values are "local" (default), "gridfs" and "s3".
+func InitStorage(cfg config.Storage) {
+	backend := cfg.Backend
+
+	var err error
+	switch backend {
+	case "local":
+		Store, err = NewLocalStore(cfg.LocalDir)
+	case "gridfs":
+		Store, err = NewGridFSStore(cfg.GridFSBucket)
+	case "s3":
+		Store, err = NewS3Store(S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey.Value(),
+			PathStyle: cfg.S3.PathStyle,
+		})
+	default:
+		err = fmt.Errorf("unknown storage backend %q", backend)
+	}
+
+	if err != nil {
+		log.Fatal("Failed to initialize blob storage: ", err)
+	}
+
+	fmt.Println("Blob storage initialized with backend:", backend)
+}
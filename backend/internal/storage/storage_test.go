@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// testBlobStore checks the behaviour every backend must have
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+
+	if _, _, err := store.Get(ctx, "missing.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing blob: got %v, want ErrNotFound", err)
+	}
+	if _, err := store.Stat(ctx, "missing.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat of a missing blob: got %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "missing.pdf"); err != nil {
+		t.Fatalf("Delete of a missing blob: %v", err)
+	}
+
+	versions := [][]byte{[]byte("%PDF-1.4 first"), []byte("%PDF-1.7 second, longer")}
+	for _, content := range versions {
+		if err := store.Put(ctx, "cv.pdf", bytes.NewReader(content), int64(len(content)), "application/pdf"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+
+		reader, info, err := store.Get(ctx, "cv.pdf")
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		got, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			t.Fatalf("reading the blob: %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Fatalf("Get returned %q, want %q", got, content)
+		}
+		if info.Size != int64(len(content)) || info.ContentType != "application/pdf" {
+			t.Fatalf("Get info = %+v, want size %d and application/pdf", info, len(content))
+		}
+
+		stat, err := store.Stat(ctx, "cv.pdf")
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		if stat.Size != int64(len(content)) {
+			t.Fatalf("Stat size = %d, want %d", stat.Size, len(content))
+		}
+	}
+
+	if err := store.Delete(ctx, "cv.pdf"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Stat(ctx, "cv.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Stat after Delete: got %v, want ErrNotFound", err)
+	}
+}
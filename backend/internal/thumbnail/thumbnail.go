@@ -0,0 +1,147 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+
+	"backend/internal/pdf"
+)
+
+// MaxPages is the number of pages, from the first, that get thumbnails
+const MaxPages = 3
+
+// Sizes maps the size names accepted by the preview endpoint to the thumbnail width in pixels
+var Sizes = map[string]int{
+	"small":  160,
+	"medium": 320,
+	"large":  640,
+}
+
+// Thumbnail is the largest image of one page as PNG, at one size
+type Thumbnail struct {
+	Page   int
+	Size   string
+	Width  int
+	Height int
+	PNG    []byte
+}
+
+// Generate extracts the largest image of the first pages of the PDF and encodes it as PNG at
+// every size. Pages are not rendered: a page without a supported image, like a text-only page,
+// gets no thumbnail, and the thumbnail of a page may be a photo or a logo instead of its layout.
+func Generate(data []byte) ([]Thumbnail, error) {
+	doc, err := pdf.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := doc.Pages()
+	if err != nil {
+		return nil, err
+	}
+
+	var thumbnails []Thumbnail
+	for i, page := range pages {
+		if i >= MaxPages {
+			break
+		}
+
+		img, err := doc.LargestImage(page)
+		if err != nil {
+			if errors.Is(err, pdf.ErrNoImage) {
+				continue
+			}
+			return nil, fmt.Errorf("page %d: %v", i+1, err)
+		}
+
+		// Converted once per page, every size is scaled from the same buffer
+		rgba := ToRGBA(img)
+		for name, width := range Sizes {
+			scaled := Resize(rgba, width)
+
+			var buffer bytes.Buffer
+			if err := png.Encode(&buffer, scaled); err != nil {
+				return nil, fmt.Errorf("could not encode thumbnail: %v", err)
+			}
+
+			thumbnails = append(thumbnails, Thumbnail{
+				Page:   i + 1,
+				Size:   name,
+				Width:  scaled.Bounds().Dx(),
+				Height: scaled.Bounds().Dy(),
+				PNG:    buffer.Bytes(),
+			})
+		}
+	}
+
+	return thumbnails, nil
+}
+
+// ToRGBA returns the image as RGBA with its origin at 0,0, RGBA images are returned as is
+func ToRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	if rgba, ok := src.(*image.RGBA); ok && bounds.Min == (image.Point{}) {
+		return rgba
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	return rgba
+}
+
+// Resize scales the image down to the given width keeping the aspect ratio, averaging
+// the source pixels covered by each destination pixel. Images are never scaled up, the
+// source is then returned itself.
+func Resize(rgba *image.RGBA, width int) *image.RGBA {
+	srcWidth, srcHeight := rgba.Bounds().Dx(), rgba.Bounds().Dy()
+	if width >= srcWidth || srcWidth == 0 {
+		return rgba
+	}
+
+	height := srcHeight * width / srcWidth
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := (y + 1) * srcHeight / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := (x + 1) * srcWidth / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, count int
+			for sy := y0; sy < y1; sy++ {
+				offset := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(rgba.Pix[offset])
+					g += int(rgba.Pix[offset+1])
+					b += int(rgba.Pix[offset+2])
+					a += int(rgba.Pix[offset+3])
+					offset += 4
+					count++
+				}
+			}
+
+			offset := dst.PixOffset(x, y)
+			dst.Pix[offset] = uint8(r / count)
+			dst.Pix[offset+1] = uint8(g / count)
+			dst.Pix[offset+2] = uint8(b / count)
+			dst.Pix[offset+3] = uint8(a / count)
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,39 @@
+package thumbnail
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestResize(t *testing.T) {
+	// Left half black, right half white, each thumbnail pixel averages two source columns
+	gray := image.NewGray(image.Rect(10, 10, 14, 12))
+	for y := 10; y < 12; y++ {
+		gray.SetGray(12, y, color.Gray{Y: 255})
+		gray.SetGray(13, y, color.Gray{Y: 255})
+	}
+
+	rgba := ToRGBA(gray)
+	if rgba.Bounds() != image.Rect(0, 0, 4, 2) {
+		t.Fatalf("ToRGBA bounds = %v", rgba.Bounds())
+	}
+	if ToRGBA(rgba) != rgba {
+		t.Fatal("ToRGBA copied an RGBA image")
+	}
+
+	scaled := Resize(rgba, 2)
+	if scaled.Bounds() != image.Rect(0, 0, 2, 1) {
+		t.Fatalf("Resize bounds = %v, want 2x1", scaled.Bounds())
+	}
+	if r, _, _, _ := scaled.At(0, 0).RGBA(); r != 0 {
+		t.Errorf("left pixel = %v, want black", scaled.At(0, 0))
+	}
+	if r, _, _, _ := scaled.At(1, 0).RGBA(); r>>8 != 255 {
+		t.Errorf("right pixel = %v, want white", scaled.At(1, 0))
+	}
+
+	if Resize(rgba, 8) != rgba {
+		t.Error("Resize scaled the image up")
+	}
+}
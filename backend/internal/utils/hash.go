@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// HashIP returns a keyed hash of the client IP, so visitors can be told apart
+// without storing their address. The key is IP_HASH_SECRET, or JWT_SECRET if unset.
+func HashIP(ip string) string {
+	mac := hmac.New(sha256.New, []byte(settings.ipHashSecret))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -2,64 +2,165 @@ package utils
 
 import (
 	"fmt"
-	"os"
+	"strings"
 	"time"
+
+	"backend/internal/models"
+
 	"github.com/golang-jwt/jwt/v5"
 )
 
 // Claims struct for JWT
 type JWTClaims struct {
-	Username string `json:"username"`
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	Purpose     string   `json:"purpose,omitempty"`
+	SessionID   string   `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateJWT creates a new JWT token for a user
-func GenerateJWT(username string) (string, int64, error) {
-	// Get the secret key from environment variable
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		secretKey = "defaultsecret" // fallback if not set in .env
+// HasPermission reports whether the token grants the permission. A permission
+// also grants its sub-scopes, analytics:read grants analytics:read:downloads.
+func (c *JWTClaims) HasPermission(permission string) bool {
+	for _, granted := range c.Permissions {
+		if granted == permission || strings.HasPrefix(permission, granted+":") {
+			return true
+		}
 	}
+	return false
+}
+
+// AccessTokenTTL is the lifetime of the access tokens, sessions are extended with refresh tokens
+const AccessTokenTTL = 15 * time.Minute
+
+// MFATokenTTL is the time left to enter the second factor after a valid password
+const MFATokenTTL = 5 * time.Minute
 
-	// Set token expiration time (e.g., 24 hours)
-	expirationTime := time.Now().Add(24 * time.Hour)
+// PurposeMFA marks the tokens that only allow to complete a two-factor login
+const PurposeMFA = "mfa"
+
+// GenerateJWT creates a new JWT token for a user, carrying its role, effective permissions and session
+func GenerateJWT(user *models.User, sessionID string) (string, int64, error) {
+	// Set token expiration time
+	now := time.Now()
+	expirationTime := now.Add(AccessTokenTTL)
+
+	// Unique token id, used to revoke the token on logout
+	tokenID, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not generate token id: %v", err)
+	}
 
 	// Create JWT claims
 	claims := &JWTClaims{
-		Username: username,
+		Username:    user.Username,
+		Role:        user.Role,
+		Permissions: user.EffectivePermissions(),
+		SessionID:   sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    os.Getenv("APP_NAME"),
+			Issuer:    settings.issuer,
 		},
 	}
 
-	// Create a new JWT token with the claims and secret key
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Sign the token with the current key of the key ring
+	signedToken, err := signClaims(claims, now)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return signedToken, expirationTime.Unix(), nil
+}
+
+// GenerateMFAToken creates the short-lived token returned by the login when the user
+// has two-factor authentication enabled. It carries no permissions, its id lets
+// /auth/mfa/verify accept it only once.
+func GenerateMFAToken(user *models.User) (string, int64, error) {
+	now := time.Now()
+	expirationTime := now.Add(MFATokenTTL)
 
-	// Sign the token with the secret key
-	signedToken, err := token.SignedString([]byte(secretKey))
+	tokenID, err := GenerateRandomToken(16)
 	if err != nil {
-		return "", 0, fmt.Errorf("could not sign token: %v", err)
+		return "", 0, fmt.Errorf("could not generate token id: %v", err)
+	}
+
+	claims := &JWTClaims{
+		Username: user.Username,
+		Purpose:  PurposeMFA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			Issuer:    settings.issuer,
+		},
+	}
+
+	signedToken, err := signClaims(claims, now)
+	if err != nil {
+		return "", 0, err
 	}
 
 	return signedToken, expirationTime.Unix(), nil
 }
 
-// ValidateJWT validates the JWT token and returns the claims if valid
+// ValidateMFAToken validates a token created by GenerateMFAToken
+func ValidateMFAToken(tokenString string) (*JWTClaims, error) {
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeMFA || claims.ID == "" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+// ValidateJWT validates the JWT token and returns the claims if valid.
+// Tokens issued for another purpose, like the MFA step, are rejected.
 func ValidateJWT(tokenString string) (*JWTClaims, error) {
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		secretKey = "defaultsecret" // fallback if not set in .env
+	claims, err := parseJWT(tokenString)
+	if err != nil {
+		return nil, err
 	}
+	if claims.Purpose != "" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+// signClaims signs the claims with the current signing key, its id goes in the kid header
+func signClaims(claims *JWTClaims, now time.Time) (string, error) {
+	key, err := currentSigningKey(now)
+	if err != nil {
+		return "", fmt.Errorf("could not sign token: %v", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = key.ID
 
-	// Parse and validate the token
+	signedToken, err := token.SignedString(key.Private)
+	if err != nil {
+		return "", fmt.Errorf("could not sign token: %v", err)
+	}
+	return signedToken, nil
+}
+
+func parseJWT(tokenString string) (*JWTClaims, error) {
+	// Parse and validate the token, the kid selects the verification key
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		keyID, _ := token.Header["kid"].(string)
+		if keyID == "" {
+			return nil, fmt.Errorf("missing key id")
 		}
-		return []byte(secretKey), nil
-	})
+		key, ok := lookupVerificationKey(keyID, time.Now())
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %s", keyID)
+		}
+		return key, nil
+	}, jwt.WithValidMethods([]string{SigningAlgorithm}))
 
 	if err != nil {
 		return nil, fmt.Errorf("could not parse token: %v", err)
@@ -72,4 +173,4 @@ func ValidateJWT(tokenString string) (*JWTClaims, error) {
 	}
 
 	return claims, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"backend/internal/models"
+)
+
+func setTestSigningKey(t *testing.T) {
+	t.Helper()
+	now := time.Now().Add(-time.Minute)
+	key, err := GenerateSigningKey(now, now, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSigningKeys([]SigningKey{*key})
+	t.Cleanup(func() { SetSigningKeys(nil) })
+}
+
+func TestMFAToken(t *testing.T) {
+	setTestSigningKey(t)
+	user := &models.User{Username: "jane", Role: models.RoleOwner}
+
+	first, _, err := GenerateMFAToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := GenerateMFAToken(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ValidateMFAToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Username != "jane" || len(claims.Permissions) != 0 {
+		t.Fatalf("claims = %+v, want jane without permissions", claims)
+	}
+	if claims.ID == "" {
+		t.Fatal("MFA token without id, it could not be consumed")
+	}
+	if other, _ := ValidateMFAToken(second); other == nil || other.ID == claims.ID {
+		t.Fatal("two MFA tokens share the same id")
+	}
+
+	// An MFA token is not an access token and the other way around
+	if _, err := ValidateJWT(first); err == nil {
+		t.Fatal("ValidateJWT accepted an MFA token")
+	}
+	access, _, err := GenerateJWT(user, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateMFAToken(access); err == nil {
+		t.Fatal("ValidateMFAToken accepted an access token")
+	}
+}
@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SigningAlgorithm is the JWS algorithm of the access tokens
+const SigningAlgorithm = "EdDSA"
+
+// MinJWTSecretLength is the minimum length of JWT_SECRET, which encrypts the signing keys at rest
+const MinJWTSecretLength = 32
+
+// insecureSecrets are values from examples and old fallbacks, refused at startup
+var insecureSecrets = []string{"defaultsecret", "my_secret_jwt", "secret", "changeme", "change_me"}
+
+// settings are the secrets and the issuer of the tokens, set on startup by Configure
+var settings = struct {
+	jwtSecret    string
+	ipHashSecret string
+	issuer       string
+}{}
+
+// Configure sets JWT_SECRET, which encrypts the signing keys, the key of HashIP and the issuer of the tokens
+func Configure(jwtSecret, ipHashSecret, issuer string) {
+	settings.jwtSecret = jwtSecret
+	settings.ipHashSecret = ipHashSecret
+	settings.issuer = issuer
+}
+
+// SigningKey is an Ed25519 key of the key ring. A key is published from CreatedAt, signs
+// from SignFrom until RotateAt, then only verifies until ExpiresAt so tokens signed just
+// before the rotation stay valid.
+type SigningKey struct {
+	ID        string
+	Private   ed25519.PrivateKey
+	Public    ed25519.PublicKey
+	CreatedAt time.Time
+	SignFrom  time.Time
+	RotateAt  time.Time
+	ExpiresAt time.Time
+}
+
+// JWK is the public part of a signing key, as published in the JWKS
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// JWKSet is the document served on /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+var keyRing = struct {
+	sync.RWMutex
+	keys []SigningKey
+}{}
+
+// ReloadSigningKeys is called when a token has an unknown kid, another instance may
+// have rotated the key. It is set by the package that persists the keys.
+var ReloadSigningKeys func() error
+
+var lastReload = struct {
+	sync.Mutex
+	at time.Time
+}{}
+
+// reloadInterval limits the reloads triggered by unknown kids
+const reloadInterval = time.Minute
+
+// CheckJWTSecret returns an error if JWT_SECRET is missing, too short or a known default
+func CheckJWTSecret(secret string) error {
+	if secret == "" {
+		return fmt.Errorf("JWT_SECRET is not set")
+	}
+	for _, insecure := range insecureSecrets {
+		if strings.EqualFold(secret, insecure) {
+			return fmt.Errorf("JWT_SECRET uses an insecure default value")
+		}
+	}
+	if len(secret) < MinJWTSecretLength {
+		return fmt.Errorf("JWT_SECRET must be at least %d characters long", MinJWTSecretLength)
+	}
+	return nil
+}
+
+// GenerateSigningKey creates a new key published now, signing from signFrom until
+// signFrom+rotation and verifying for grace more
+func GenerateSigningKey(now, signFrom time.Time, rotation, grace time.Duration) (*SigningKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate signing key: %v", err)
+	}
+
+	keyID, err := GenerateRandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:        keyID,
+		Private:   private,
+		Public:    public,
+		CreatedAt: now,
+		SignFrom:  signFrom,
+		RotateAt:  signFrom.Add(rotation),
+		ExpiresAt: signFrom.Add(rotation + grace),
+	}, nil
+}
+
+// SetSigningKeys replaces the key ring
+func SetSigningKeys(keys []SigningKey) {
+	sorted := append([]SigningKey{}, keys...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].CreatedAt.After(sorted[j].CreatedAt) })
+
+	keyRing.Lock()
+	keyRing.keys = sorted
+	keyRing.Unlock()
+}
+
+// currentSigningKey returns the newest key allowed to sign, keys published ahead are
+// skipped until their SignFrom. When the rotation is late, the newest key still
+// verifying is used so tokens can always be issued.
+func currentSigningKey(now time.Time) (*SigningKey, error) {
+	keyRing.RLock()
+	defer keyRing.RUnlock()
+
+	for i := range keyRing.keys {
+		if !now.Before(keyRing.keys[i].SignFrom) && now.Before(keyRing.keys[i].RotateAt) {
+			return &keyRing.keys[i], nil
+		}
+	}
+	for i := range keyRing.keys {
+		if !now.Before(keyRing.keys[i].SignFrom) && now.Before(keyRing.keys[i].ExpiresAt) {
+			return &keyRing.keys[i], nil
+		}
+	}
+	for i := range keyRing.keys {
+		if now.Before(keyRing.keys[i].ExpiresAt) {
+			return &keyRing.keys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no signing key available")
+}
+
+// verificationKey returns the public key of kid if it can still verify tokens
+func verificationKey(keyID string, now time.Time) (ed25519.PublicKey, bool) {
+	keyRing.RLock()
+	defer keyRing.RUnlock()
+
+	for _, key := range keyRing.keys {
+		if key.ID == keyID && now.Before(key.ExpiresAt) {
+			return key.Public, true
+		}
+	}
+	return nil, false
+}
+
+// lookupVerificationKey is verificationKey reloading the key ring once in a while for unknown kids
+func lookupVerificationKey(keyID string, now time.Time) (ed25519.PublicKey, bool) {
+	if key, ok := verificationKey(keyID, now); ok {
+		return key, true
+	}
+	if ReloadSigningKeys == nil {
+		return nil, false
+	}
+
+	lastReload.Lock()
+	if now.Sub(lastReload.at) < reloadInterval {
+		lastReload.Unlock()
+		return nil, false
+	}
+	lastReload.at = now
+	lastReload.Unlock()
+
+	if err := ReloadSigningKeys(); err != nil {
+		fmt.Println("Error reloading signing keys", err)
+		return nil, false
+	}
+	return verificationKey(keyID, now)
+}
+
+// PublicJWKS returns the public keys still verifying tokens, and those published ahead of their use
+func PublicJWKS(now time.Time) JWKSet {
+	keyRing.RLock()
+	defer keyRing.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range keyRing.keys {
+		if !now.Before(key.ExpiresAt) {
+			continue
+		}
+		set.Keys = append(set.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key.Public),
+			KeyID:     key.ID,
+			Algorithm: SigningAlgorithm,
+			Use:       "sig",
+		})
+	}
+	return set
+}
+
+// EncryptPrivateKey seals the seed of the private key with AES-GCM, keyed by JWT_SECRET
+func EncryptPrivateKey(private ed25519.PrivateKey) (string, error) {
+	gcm, err := keyEncryptionCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("could not read random bytes: %v", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, private.Seed(), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptPrivateKey opens a private key sealed by EncryptPrivateKey
+func DecryptPrivateKey(encrypted string) (ed25519.PrivateKey, error) {
+	gcm, err := keyEncryptionCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted key")
+	}
+
+	seed, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt key, was JWT_SECRET changed? %v", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid key seed")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func keyEncryptionCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte("jwt-signing-keys:" + settings.jwtSecret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("could not create cipher: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyPublishedAhead(t *testing.T) {
+	now := time.Now()
+	current, err := GenerateSigningKey(now.Add(-time.Hour), now.Add(-time.Hour), 2*time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := GenerateSigningKey(now, current.RotateAt, 2*time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSigningKeys([]SigningKey{*current, *next})
+	t.Cleanup(func() { SetSigningKeys(nil) })
+
+	published := map[string]bool{}
+	for _, jwk := range PublicJWKS(now).Keys {
+		published[jwk.KeyID] = true
+	}
+	if !published[current.ID] || !published[next.ID] {
+		t.Fatalf("JWKS has %v, want both the current and the next key", published)
+	}
+
+	steps := []struct {
+		at   time.Time
+		want string
+	}{
+		{now, current.ID},
+		{current.RotateAt.Add(-time.Second), current.ID},
+		{current.RotateAt, next.ID},
+		{next.RotateAt.Add(time.Minute), next.ID}, // late rotation
+	}
+	for _, step := range steps {
+		key, err := currentSigningKey(step.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key.ID != step.want {
+			t.Errorf("signing key at %v = %s, want %s", step.at.Sub(now), key.ID, step.want)
+		}
+	}
+}
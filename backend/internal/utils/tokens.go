@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// GenerateRandomToken returns a URL-safe random string built from n random bytes
+func GenerateRandomToken(n int) (string, error) {
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("could not read random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
+
+// HashToken returns the SHA-256 of an opaque token. Only the hash is stored in the database,
+// tokens are high entropy so a plain hash is enough.
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
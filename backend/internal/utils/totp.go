@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238), the defaults understood by every authenticator app
+const (
+	TOTPPeriod = 30
+	TOTPDigits = 6
+	// TOTPSkew is the number of periods accepted before and after the current one
+	TOTPSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random 160 bit secret encoded in base32
+func GenerateTOTPSecret() (string, error) {
+	buffer := make([]byte, 20)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", fmt.Errorf("could not read random bytes: %v", err)
+	}
+	return totpEncoding.EncodeToString(buffer), nil
+}
+
+// TOTPURI returns the otpauth URI displayed as QR code during enrolment
+func TOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(TOTPDigits))
+	params.Set("period", fmt.Sprint(TOTPPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// TOTPStep returns the time step of t
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / TOTPPeriod
+}
+
+// TOTPCode returns the code of the secret for the given time step (RFC 4226 HOTP)
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %v", err)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%modulo), nil
+}
+
+// ValidateTOTP checks the code against the steps around t and returns the matching
+// step, callers store it to refuse the same code twice. It returns 0 if the code is wrong.
+func ValidateTOTP(secret, code string, t time.Time) int64 {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != TOTPDigits {
+		return 0
+	}
+
+	current := TOTPStep(t)
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return 0
+}
+
+// GenerateRecoveryCodes returns n one-time codes formatted as xxxxx-xxxxx
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		buffer := make([]byte, 6)
+		if _, err := rand.Read(buffer); err != nil {
+			return nil, fmt.Errorf("could not read random bytes: %v", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(buffer))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode hashes a recovery code, ignoring case, spaces and dashes
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashToken(normalized)
+}
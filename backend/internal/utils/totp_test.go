@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of the RFC 6238 test vectors
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// RFC 6238 appendix B gives 8 digits, the 6 digit codes are their last digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		code, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.code {
+			t.Errorf("TOTPCode at %d = %s, want %s", test.unix, code, test.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := TOTPStep(now)
+
+	tests := []struct {
+		name string
+		code string
+		want int64
+	}{
+		{"current step", "050471", step},
+		{"with spaces", " 050 471 ", step},
+		{"previous step", "081804", step - 1},
+		{"two steps ago", mustTOTPCode(t, step-2), 0},
+		{"next step", mustTOTPCode(t, step+1), step + 1},
+		{"wrong code", "123456", 0},
+		{"too short", "05047", 0},
+		{"not digits", "abcdef", 0},
+	}
+	for _, test := range tests {
+		if got := ValidateTOTP(rfc6238Secret, test.code, now); got != test.want {
+			t.Errorf("%s: ValidateTOTP(%q) = %d, want %d", test.name, test.code, got, test.want)
+		}
+	}
+
+	if got := ValidateTOTP("not base32!", "050471", now); got != 0 {
+		t.Errorf("invalid secret: ValidateTOTP = %d, want 0", got)
+	}
+}
+
+func mustTOTPCode(t *testing.T, step int64) string {
+	t.Helper()
+	code, err := TOTPCode(rfc6238Secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 || strings.ContainsRune(secret, '=') {
+		t.Fatalf("secret %q, want 32 base32 characters without padding", secret)
+	}
+	if _, err := TOTPCode(secret, 1); err != nil {
+		t.Fatalf("generated secret not usable: %v", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q, want xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+
+	hash := HashRecoveryCode("abcde-fghij")
+	for _, variant := range []string{"ABCDE-FGHIJ", "abcdefghij", "abcde fghij"} {
+		if HashRecoveryCode(variant) != hash {
+			t.Errorf("HashRecoveryCode(%q) differs from abcde-fghij", variant)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// maxCBORDepth bounds the nesting of decoded items, authenticator data is shallow
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first CBOR item of data and returns it with the number of bytes read.
+// Only the subset used by WebAuthn is supported: integers, byte and text strings, arrays,
+// maps, booleans and null. Integers are returned as int64, maps as map[interface{}]interface{}.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	decoder := cborDecoder{data: data}
+	value, err := decoder.item(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, decoder.pos, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) item(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("cbor: too deeply nested")
+	}
+
+	major, argument, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if argument > 1<<63-1 {
+			return nil, fmt.Errorf("cbor: integer overflow")
+		}
+		return int64(argument), nil
+	case 1:
+		if argument > 1<<63-1 {
+			return nil, fmt.Errorf("cbor: integer overflow")
+		}
+		return -1 - int64(argument), nil
+	case 2, 3:
+		bytes, err := d.bytes(argument)
+		if err != nil {
+			return nil, err
+		}
+		if major == 3 {
+			return string(bytes), nil
+		}
+		return bytes, nil
+	case 4:
+		if argument > uint64(len(d.data)) {
+			return nil, fmt.Errorf("cbor: array too long")
+		}
+		array := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			value, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	case 5:
+		if argument > uint64(len(d.data)) {
+			return nil, fmt.Errorf("cbor: map too long")
+		}
+		object := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key")
+			}
+			value, err := d.item(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			object[key] = value
+		}
+		return object, nil
+	case 7:
+		switch argument {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("cbor: unsupported item (major type %d)", major)
+}
+
+// head reads the initial byte and its argument. Indefinite lengths are not supported.
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.pos >= len(d.data) {
+		return 0, 0, fmt.Errorf("cbor: unexpected end of data")
+	}
+	initial := d.data[d.pos]
+	d.pos++
+
+	major := initial >> 5
+	info := initial & 0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		bytes, err := d.bytes(uint64(size))
+		if err != nil {
+			return 0, 0, err
+		}
+		var argument uint64
+		switch size {
+		case 1:
+			argument = uint64(bytes[0])
+		case 2:
+			argument = uint64(binary.BigEndian.Uint16(bytes))
+		case 4:
+			argument = uint64(binary.BigEndian.Uint32(bytes))
+		case 8:
+			argument = binary.BigEndian.Uint64(bytes)
+		}
+		return major, argument, nil
+	default:
+		return 0, 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+}
+
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("cbor: unexpected end of data")
+	}
+	bytes := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return bytes, nil
+}
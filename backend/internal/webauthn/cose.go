@@ -0,0 +1,110 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms accepted for credentials, in order of preference
+const (
+	AlgES256 int64 = -7
+	AlgEdDSA int64 = -8
+	AlgRS256 int64 = -257
+)
+
+// SupportedAlgorithms are offered to the authenticator on registration
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters (RFC 9053)
+const (
+	coseKeyType   int64 = 1
+	coseAlgorithm int64 = 3
+	coseCurve     int64 = -1
+	coseX         int64 = -2
+	coseY         int64 = -3
+	coseRSAN      int64 = -1
+	coseRSAE      int64 = -2
+
+	coseKeyTypeOKP int64 = 1
+	coseKeyTypeEC2 int64 = 2
+	coseKeyTypeRSA int64 = 3
+
+	coseCurveP256    int64 = 1
+	coseCurveEd25519 int64 = 6
+)
+
+// publicKey is a credential public key decoded from its COSE encoding
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key of a supported algorithm
+func parsePublicKey(cose []byte) (*publicKey, error) {
+	decoded, _, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, err
+	}
+	params, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("public key is not a COSE key")
+	}
+
+	keyType, _ := params[coseKeyType].(int64)
+	algorithm, _ := params[coseAlgorithm].(int64)
+
+	switch {
+	case algorithm == AlgES256 && keyType == coseKeyTypeEC2:
+		curve, _ := params[coseCurve].(int64)
+		x, _ := params[coseX].([]byte)
+		y, _ := params[coseY].([]byte)
+		if curve != coseCurveP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid ES256 key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("invalid ES256 key")
+		}
+		return &publicKey{algorithm: algorithm, key: key}, nil
+
+	case algorithm == AlgEdDSA && keyType == coseKeyTypeOKP:
+		curve, _ := params[coseCurve].(int64)
+		x, _ := params[coseX].([]byte)
+		if curve != coseCurveEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid EdDSA key")
+		}
+		return &publicKey{algorithm: algorithm, key: ed25519.PublicKey(x)}, nil
+
+	case algorithm == AlgRS256 && keyType == coseKeyTypeRSA:
+		n, _ := params[coseRSAN].([]byte)
+		e, _ := params[coseRSAE].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RS256 key")
+		}
+		exponent := new(big.Int).SetBytes(e)
+		return &publicKey{algorithm: algorithm, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key algorithm %d", algorithm)
+}
+
+// verify checks the signature of data
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		hash := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, hash[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		hash := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil
+	}
+	return false
+}
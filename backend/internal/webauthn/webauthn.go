@@ -0,0 +1,233 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend/internal/config"
+)
+
+// RelyingParty is the backend as seen by the authenticators: credentials are scoped
+// to ID, a domain, and ceremonies are only accepted from Origins.
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Global variable to hold the relying party, nil when WebAuthn is disabled
+var Default *RelyingParty
+
+// Credential is a public key credential created by a registration ceremony
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	Algorithm int64
+	SignCount uint32
+}
+
+// ErrSignCount is returned when the signature counter did not increase, the
+// authenticator may have been cloned
+var ErrSignCount = errors.New("signature counter did not increase")
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+	flagExtensions   = 0x80
+)
+
+// InitWebAuthn configures the relying party. WEBAUTHN_ORIGINS defaults to ALLOW_ORIGIN
+// and WEBAUTHN_RP_ID to the host of the first origin.
+func InitWebAuthn(cfg config.WebAuthn) {
+	if cfg.RPID == "" {
+		fmt.Println("WebAuthn disabled (no WEBAUTHN_RP_ID or ALLOW_ORIGIN)")
+		return
+	}
+
+	Default = &RelyingParty{ID: cfg.RPID, Name: cfg.RPName, Origins: cfg.Origins}
+	fmt.Println("WebAuthn enabled for", cfg.RPID)
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create and returns the
+// new credential. User verification is required, a passkey can be the only factor.
+// The attestation statement is not verified, registration asks for no attestation.
+func (rp *RelyingParty) VerifyRegistration(clientDataJSON, attestationObject []byte, challenge string) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %v", err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid attestation object")
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("attestation object has no authenticator data")
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttested == 0 || len(authData.credentialID) == 0 {
+		return nil, fmt.Errorf("authenticator data has no credential")
+	}
+
+	key, err := parsePublicKey(authData.publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		Algorithm: key.algorithm,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get with the stored public key
+// and returns the new signature counter
+func (rp *RelyingParty) VerifyAssertion(clientDataJSON, rawAuthData, signature []byte, challenge string, cosePublicKey []byte, storedSignCount uint32) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(cosePublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	// The signature covers the authenticator data and the hash of the client data
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, rawAuthData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return 0, fmt.Errorf("invalid signature")
+	}
+
+	// Authenticators without a counter always send 0
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, ErrSignCount
+	}
+	return authData.signCount, nil
+}
+
+// ClientDataChallenge returns the challenge signed by the authenticator, used to find the pending ceremony
+func ClientDataChallenge(clientDataJSON []byte) (string, error) {
+	var clientData struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil || clientData.Challenge == "" {
+		return "", fmt.Errorf("invalid client data")
+	}
+	return strings.TrimRight(clientData.Challenge, "="), nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony, challenge string) error {
+	var clientData struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("invalid client data: %v", err)
+	}
+
+	if clientData.Type != ceremony {
+		return fmt.Errorf("unexpected ceremony %q", clientData.Type)
+	}
+	if challenge == "" || strings.TrimRight(clientData.Challenge, "=") != challenge {
+		return fmt.Errorf("challenge mismatch")
+	}
+	if clientData.CrossOrigin {
+		return fmt.Errorf("cross-origin ceremonies are not allowed")
+	}
+	for _, origin := range rp.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", clientData.Origin)
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// verifyAuthenticatorData parses the authenticator data and checks the relying party
+// and the user presence and verification flags
+func (rp *RelyingParty) verifyAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("authenticator data too short")
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return nil, fmt.Errorf("credential belongs to another relying party")
+	}
+
+	authData := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("user not present")
+	}
+	if authData.flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("user not verified")
+	}
+
+	rest := data[37:]
+	if authData.flags&flagAttested != 0 {
+		// AAGUID (16 bytes), credential id length (2 bytes), credential id, COSE key
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("attested credential data too short")
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLength == 0 || idLength > 1023 || len(rest) < idLength {
+			return nil, fmt.Errorf("invalid credential id")
+		}
+		authData.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, keyLength, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %v", err)
+		}
+		authData.publicKey = rest[:keyLength]
+		rest = rest[keyLength:]
+	}
+	if authData.flags&flagExtensions != 0 {
+		_, extensionsLength, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extensions: %v", err)
+		}
+		rest = rest[extensionsLength:]
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("trailing bytes in authenticator data")
+	}
+
+	return authData, nil
+}
@@ -0,0 +1,307 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+const (
+	testOrigin    = "https://app.example.com"
+	testChallenge = "Y2hhbGxlbmdl"
+)
+
+var testRP = &RelyingParty{ID: "example.com", Name: "Example", Origins: []string{testOrigin}}
+
+// cborMap is a CBOR map written with its keys in order
+type cborMap [][2]interface{}
+
+// encodeCBOR writes the subset of CBOR read by decodeCBOR
+func encodeCBOR(b *bytes.Buffer, value interface{}) {
+	head := func(major byte, argument uint64) {
+		switch {
+		case argument < 24:
+			b.WriteByte(major<<5 | byte(argument))
+		case argument < 1<<8:
+			b.Write([]byte{major<<5 | 24, byte(argument)})
+		case argument < 1<<16:
+			b.WriteByte(major<<5 | 25)
+			binary.Write(b, binary.BigEndian, uint16(argument))
+		default:
+			b.WriteByte(major<<5 | 26)
+			binary.Write(b, binary.BigEndian, uint32(argument))
+		}
+	}
+
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			head(1, uint64(-1-v))
+		} else {
+			head(0, uint64(v))
+		}
+	case []byte:
+		head(2, uint64(len(v)))
+		b.Write(v)
+	case string:
+		head(3, uint64(len(v)))
+		b.WriteString(v)
+	case cborMap:
+		head(5, uint64(len(v)))
+		for _, pair := range v {
+			encodeCBOR(b, pair[0])
+			encodeCBOR(b, pair[1])
+		}
+	default:
+		panic("unsupported CBOR value")
+	}
+}
+
+func cbor(value interface{}) []byte {
+	var b bytes.Buffer
+	encodeCBOR(&b, value)
+	return b.Bytes()
+}
+
+// authenticator is a software authenticator holding one credential
+type authenticator struct {
+	credentialID []byte
+	signer       crypto.Signer
+	cose         []byte
+	hash         crypto.Hash // zero for Ed25519, which signs the message itself
+	signCount    uint32
+	flags        byte
+}
+
+func newAuthenticator(t *testing.T, algorithm int64) *authenticator {
+	t.Helper()
+	a := &authenticator{credentialID: []byte("credential-1"), flags: flagUserPresent | flagUserVerified, hash: crypto.SHA256}
+
+	switch algorithm {
+	case AlgES256:
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.signer = key
+		a.cose = cbor(cborMap{
+			{coseKeyType, coseKeyTypeEC2}, {coseAlgorithm, AlgES256}, {coseCurve, coseCurveP256},
+			{coseX, key.X.FillBytes(make([]byte, 32))}, {coseY, key.Y.FillBytes(make([]byte, 32))},
+		})
+	case AlgEdDSA:
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.signer, a.hash = private, 0
+		a.cose = cbor(cborMap{{coseKeyType, coseKeyTypeOKP}, {coseAlgorithm, AlgEdDSA}, {coseCurve, coseCurveEd25519}, {coseX, []byte(public)}})
+	case AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.signer = key
+		a.cose = cbor(cborMap{
+			{coseKeyType, coseKeyTypeRSA}, {coseAlgorithm, AlgRS256},
+			{coseRSAN, key.N.Bytes()}, {coseRSAE, big.NewInt(int64(key.E)).Bytes()},
+		})
+	}
+	return a
+}
+
+// authData returns the authenticator data for rpID, with the attested credential when attested is true
+func (a *authenticator) authData(rpID string, attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	flags := a.flags
+	if attested {
+		flags |= flagAttested
+	}
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...) // AAGUID
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.cose...)
+	}
+	return data
+}
+
+func clientData(ceremony, challenge, origin string) []byte {
+	data, _ := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": origin})
+	return data
+}
+
+// create answers navigator.credentials.create with the "none" attestation format
+func (a *authenticator) create(challenge, origin string) (clientDataJSON, attestationObject []byte) {
+	attestation := cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", a.authData(testRP.ID, true)}}
+	return clientData("webauthn.create", challenge, origin), cbor(attestation)
+}
+
+// get answers navigator.credentials.get, the counter is increased first
+func (a *authenticator) get(challenge, origin string) (clientDataJSON, authData, signature []byte) {
+	a.signCount++
+	clientDataJSON = clientData("webauthn.get", challenge, origin)
+	authData = a.authData(testRP.ID, false)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+
+	digest := signed
+	if a.hash != 0 {
+		hash := sha256.Sum256(signed)
+		digest = hash[:]
+	}
+	signature, err := a.signer.Sign(rand.Reader, digest, a.hash)
+	if err != nil {
+		panic(err)
+	}
+	return clientDataJSON, authData, signature
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	for _, algorithm := range SupportedAlgorithms {
+		a := newAuthenticator(t, algorithm)
+
+		clientDataJSON, attestationObject := a.create(testChallenge, testOrigin)
+		credential, err := testRP.VerifyRegistration(clientDataJSON, attestationObject, testChallenge)
+		if err != nil {
+			t.Fatalf("algorithm %d: VerifyRegistration: %v", algorithm, err)
+		}
+		if !bytes.Equal(credential.ID, a.credentialID) || credential.Algorithm != algorithm {
+			t.Fatalf("algorithm %d: credential = %+v", algorithm, credential)
+		}
+
+		clientDataJSON, authData, signature := a.get(testChallenge, testOrigin)
+		signCount, err := testRP.VerifyAssertion(clientDataJSON, authData, signature, testChallenge, credential.PublicKey, credential.SignCount)
+		if err != nil {
+			t.Fatalf("algorithm %d: VerifyAssertion: %v", algorithm, err)
+		}
+		if signCount != 1 {
+			t.Fatalf("algorithm %d: sign count = %d, want 1", algorithm, signCount)
+		}
+	}
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(a *authenticator) (clientDataJSON, attestationObject []byte)
+	}{
+		{"other origin", func(a *authenticator) ([]byte, []byte) { return a.create(testChallenge, "https://evil.example.com") }},
+		{"other challenge", func(a *authenticator) ([]byte, []byte) { return a.create("b3RoZXI", testOrigin) }},
+		{"user not verified", func(a *authenticator) ([]byte, []byte) {
+			a.flags = flagUserPresent
+			return a.create(testChallenge, testOrigin)
+		}},
+		{"assertion ceremony", func(a *authenticator) ([]byte, []byte) {
+			_, attestationObject := a.create(testChallenge, testOrigin)
+			return clientData("webauthn.get", testChallenge, testOrigin), attestationObject
+		}},
+		{"other relying party", func(a *authenticator) ([]byte, []byte) {
+			clientDataJSON, _ := a.create(testChallenge, testOrigin)
+			return clientDataJSON, cbor(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", a.authData("evil.example.com", true)}})
+		}},
+		{"no credential", func(a *authenticator) ([]byte, []byte) {
+			clientDataJSON, _ := a.create(testChallenge, testOrigin)
+			return clientDataJSON, cbor(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", a.authData(testRP.ID, false)}})
+		}},
+		{"unsupported key", func(a *authenticator) ([]byte, []byte) {
+			a.cose = cbor(cborMap{{coseKeyType, coseKeyTypeEC2}, {coseAlgorithm, int64(-35)}})
+			return a.create(testChallenge, testOrigin)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := newAuthenticator(t, AlgEdDSA)
+			clientDataJSON, attestationObject := test.change(a)
+			if _, err := testRP.VerifyRegistration(clientDataJSON, attestationObject, testChallenge); err == nil {
+				t.Fatal("VerifyRegistration succeeded")
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	a := newAuthenticator(t, AlgES256)
+	clientDataJSON, attestationObject := a.create(testChallenge, testOrigin)
+	credential, err := testRP.VerifyRegistration(clientDataJSON, attestationObject, testChallenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func(clientDataJSON, authData, signature []byte, storedSignCount uint32) error {
+		_, err := testRP.VerifyAssertion(clientDataJSON, authData, signature, testChallenge, credential.PublicKey, storedSignCount)
+		return err
+	}
+
+	clientDataJSON, authData, signature := a.get(testChallenge, testOrigin)
+	if err := verify(clientDataJSON, authData, signature, 0); err != nil {
+		t.Fatalf("valid assertion: %v", err)
+	}
+	if err := verify(clientDataJSON, authData, signature, 1); !errors.Is(err, ErrSignCount) {
+		t.Fatalf("replayed counter: got %v, want ErrSignCount", err)
+	}
+
+	tampered := bytes.Clone(authData)
+	tampered[33+3]++
+	if err := verify(clientDataJSON, tampered, signature, 0); err == nil {
+		t.Fatal("tampered authenticator data accepted")
+	}
+
+	clientDataJSON, authData, signature = a.get("b3RoZXI", testOrigin)
+	if err := verify(clientDataJSON, authData, signature, 1); err == nil {
+		t.Fatal("assertion of another challenge accepted")
+	}
+
+	other := newAuthenticator(t, AlgES256)
+	other.signCount = 5
+	clientDataJSON, authData, signature = other.get(testChallenge, testOrigin)
+	if err := verify(clientDataJSON, authData, signature, 1); err == nil {
+		t.Fatal("assertion signed by another key accepted")
+	}
+
+	// Authenticators without a counter always send 0
+	a.signCount = 0
+	clientDataJSON, authData, signature = a.get(testChallenge, testOrigin)
+	binary.BigEndian.PutUint32(authData[33:37], 0)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, _ = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err := verify(clientDataJSON, authData, signature, 0); err != nil {
+		t.Fatalf("assertion without counter: %v", err)
+	}
+}
+
+func TestClientDataChallenge(t *testing.T) {
+	challenge, err := ClientDataChallenge(clientData("webauthn.get", base64.URLEncoding.EncodeToString([]byte("challenge")), testOrigin))
+	if err != nil || challenge != testChallenge {
+		t.Fatalf("ClientDataChallenge = %q, %v, want %q", challenge, err, testChallenge)
+	}
+	if _, err := ClientDataChallenge([]byte(`{"type":"webauthn.get"}`)); err == nil {
+		t.Fatal("client data without a challenge accepted")
+	}
+}
+
+func TestDecodeCBORLimits(t *testing.T) {
+	nested := bytes.Repeat([]byte{0x81}, maxCBORDepth+2) // arrays of one item
+	nested = append(nested, 0x00)
+	if _, _, err := decodeCBOR(nested); err == nil {
+		t.Fatal("deeply nested item accepted")
+	}
+	if _, _, err := decodeCBOR([]byte{0x5a, 0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Fatal("byte string longer than the data accepted")
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,97 +11,223 @@ import (
 	"syscall"
 	"time"
 
+	"backend/internal/audit"
 	"backend/internal/auth"
+	"backend/internal/config"
+	"backend/internal/cors"
 	"backend/internal/handlers"
+	"backend/internal/mailer"
+	"backend/internal/models"
+	"backend/internal/oidc"
+	"backend/internal/storage"
+	"backend/internal/webauthn"
 	"backend/mongodb"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
-func loadEnvFile() {
-	// Load environment variables
-	appEnv := os.Getenv("APP_ENV")
-	if appEnv == "" {
-		appEnv = "local"
+// setupRouter registers every route in a public, authenticated or permissioned group,
+// the returned router knows the authentication and CORS policy of each route
+func setupRouter(corsConfig config.CORS, trustedProxies []string) (*gin.Engine, *auth.Router) {
+	// Create a Gin router instance
+	r := gin.Default()
+
+	// The client IP keys the login throttling and the visitor hashes, X-Forwarded-For
+	// is only read from the configured reverse proxies, never from the client itself
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal(err)
 	}
 
-	var envFile string
-	switch appEnv {
-	case "prod":
-		envFile = ".env.prod"
-	case "dev":
-		envFile = ".env.dev"
-	default:
-		envFile = ".env.local"
+	// The frontend calls the authentication and admin routes with credentials (cookies in
+	// cookie mode), tracking and CV routes are called without credentials
+	frontendCORS := &cors.Policy{
+		Origins:          corsConfig.Origins,
+		AllowCredentials: true,
+		AllowHeaders:     cors.DefaultAllowHeaders,
+		ExposeHeaders:    cors.DefaultExposeHeaders,
+		MaxAge:           corsConfig.MaxAge,
+	}
+	publicCORS := &cors.Policy{
+		Origins:       corsConfig.PublicOrigins,
+		AllowHeaders:  []string{"Content-Type", "Range", "If-None-Match", "If-Modified-Since"},
+		ExposeHeaders: cors.DefaultExposeHeaders,
+		MaxAge:        corsConfig.MaxAge,
 	}
 
-	err := godotenv.Load(envFile)
-	if err != nil {
-		log.Fatalf("Error loading .env file for environment %s: %v", appEnv, err)
+	router := auth.NewRouter(r, frontendCORS)
+
+	// Probes of the container orchestrator and build information, never called by browsers
+	probes := router.WithCORS(nil).Public("")
+	{
+		probes.GET("/healthz", handlers.Healthz)
+		probes.GET("/readyz", handlers.Readyz)
+		probes.GET("/version", handlers.Version)
+	}
+
+	// Public routes (no authentication required)
+	public := router.Public("")
+	{
+		//public.POST("/register", auth.Register)
+		public.POST("/login", auth.Login)
+		public.POST("/auth/refresh", auth.Refresh)
+		public.POST("/auth/logout", auth.Logout)
+		public.POST("/auth/mfa/verify", auth.VerifyMFA)
+		public.POST("/auth/invitations/accept", auth.AcceptInvitation)
+		public.POST("/auth/forgot", auth.ForgotPassword)
+		public.POST("/auth/reset", auth.ResetPassword)
+		public.GET("/auth/oidc/login", auth.OIDCLogin)
+		public.POST("/auth/oidc/callback", auth.OIDCCallback)
+		public.POST("/auth/webauthn/login/begin", auth.BeginPasskeyLogin)
+		public.POST("/auth/webauthn/login/finish", auth.FinishPasskeyLogin)
+	}
+
+	// Public routes callable from any allowed public origin, without credentials
+	tracking := router.WithCORS(publicCORS).Public("")
+	{
+		tracking.GET("/.well-known/jwks.json", auth.JWKS)
+		tracking.GET("/cv/download", handlers.DownloadCV)
+		tracking.HEAD("/cv/download", handlers.DownloadCV)
+		tracking.GET("/cv/preview", handlers.GetCVPreview)
+
+		// Tracking Route for users
+		tracking.POST("/info", handlers.TrackData)
+	}
+
+	// Protected routes (authentication required)
+
+	// CV management for admin area
+	cvGroup := router.Permission("/cv", models.PermissionCVWrite)
+	{
+		cvGroup.POST("/upload", handlers.UploadCV)
+	}
+
+	// Two-factor enrolment of the current user
+	mfaGroup := router.Authenticated("/auth/mfa/totp")
+	{
+		mfaGroup.POST("/enroll", auth.EnrollTOTP)
+		mfaGroup.POST("/confirm", auth.ConfirmTOTP)
+		mfaGroup.POST("/disable", auth.DisableTOTP)
+	}
+
+	// Sessions of the current user
+	sessionsGroup := router.Authenticated("/auth/sessions")
+	{
+		sessionsGroup.GET("", auth.ListSessions)
+		sessionsGroup.DELETE("/:id", auth.RevokeSession)
+	}
+
+	// Passkeys of the current user
+	webauthnGroup := router.Authenticated("/auth/webauthn")
+	{
+		webauthnGroup.POST("/register/begin", auth.BeginPasskeyRegistration)
+		webauthnGroup.POST("/register/finish", auth.FinishPasskeyRegistration)
+		webauthnGroup.GET("/credentials", auth.ListPasskeys)
+		webauthnGroup.DELETE("/credentials/:id", auth.DeletePasskey)
+		webauthnGroup.PUT("/passkey-only", auth.SetPasskeyOnly)
+	}
+
+	// User management and invitations for admin area
+	adminGroup := router.Permission("/admin", models.PermissionUsersManage)
+	{
+		adminGroup.GET("/users", auth.ListUsers)
+		adminGroup.PUT("/users/:id/role", auth.ChangeUserRole)
+		adminGroup.POST("/users/:id/disable", auth.DisableUser)
+		adminGroup.POST("/users/:id/enable", auth.EnableUser)
+		adminGroup.DELETE("/users/:id", auth.DeleteUser)
+		adminGroup.GET("/invitations", auth.ListInvitations)
+		adminGroup.POST("/invitations", auth.CreateInvitation)
+		adminGroup.DELETE("/invitations/:id", auth.RevokeInvitation)
+		adminGroup.GET("/api-keys", auth.ListAPIKeys)
+		adminGroup.POST("/api-keys", auth.CreateAPIKey)
+		adminGroup.DELETE("/api-keys/:id", auth.RevokeAPIKey)
 	}
 
-	fmt.Printf("Loaded environment configuration from %s\n", envFile)
+	// Audit log for admin area
+	auditGroup := router.Permission("/admin/audit", models.PermissionAuditRead)
+	{
+		auditGroup.GET("", handlers.GetAuditLog)
+		auditGroup.GET("/verify", handlers.VerifyAuditLog)
+	}
+
+	// Analytics Routes for admin area, each route has its own scope for API keys
+	router.Permission("/analytics", models.ScopeAnalyticsDailyUsers).GET("/daily-users", handlers.GetDailyUniqueUsers)
+	router.Permission("/analytics", models.ScopeAnalyticsPageTime).GET("/page-time", handlers.GetPageTimeStats)
+	router.Permission("/analytics", models.ScopeAnalyticsDownloads).GET("/downloads", handlers.GetDownloadStats)
+	router.Permission("/analytics", models.ScopeAnalyticsInteractions).GET("/interactions", handlers.GetInteractionStats)
+	router.Permission("/analytics", models.ScopeAnalyticsDevices).GET("/devices", handlers.GetDeviceStats)
+	router.Permission("/analytics", models.ScopeAnalyticsBrowsers).GET("/browsers", handlers.GetBrowserStats)
+
+	return r, router
 }
 
 func main() {
-	// Load environment variables
-	loadEnvFile()
+	// Print the route policy table for review and exit, no configuration is needed
+	printRoutes := flag.Bool("routes", false, "print the routes with their authentication policy and exit")
+	printConfig := flag.Bool("print-config", false, "print the configuration, secrets redacted, and exit")
+	flags := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	if *printRoutes {
+		gin.SetMode(gin.ReleaseMode)
+		_, router := setupRouter(config.CORS{}, nil)
+		fmt.Print(router.PolicyTable())
+		if err := router.CheckPolicies(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Load and validate the configuration, every invalid setting is reported at once
+	cfg, err := config.Load(*flags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Loaded environment configuration from %s\n", cfg.EnvFile)
+	if *printConfig {
+		cfg.Print(os.Stdout)
+		return
+	}
+
+	// Token secrets and password hashing, needed to create the root user
+	auth.Configure(cfg)
+	audit.Configure(cfg.Auth.AuditSecret.Value())
 
 	// Initialize MongoDB connection
-	mongodb.InitMongoDB()
+	mongodb.InitMongoDB(cfg.Mongo, cfg.Root)
 
-	// Create a Gin router instance
-	r := gin.Default()
-	r.Use(auth.JWTMiddleware) // Apply JWT middleware globally
-	//config := cors.DefaultConfig()
-	//allowOrigin := os.Getenv("ALLOW_ORIGIN")
-	config := cors.Config{
-		AllowOrigins:     []string{os.Getenv("ALLOW_ORIGIN")},                 // Allow your frontend origin
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}, // Allow all necessary methods
-		AllowHeaders:     []string{"Content-Type", "Authorization"},           // Include Authorization header
-		ExposeHeaders:    []string{"Content-Length"},                          // Optional: Expose headers to the client
-		AllowCredentials: true,                                                // Allow cookies and credentials if needed
-	}
-	r.Use(cors.New(config))
-
-	r.Use(cors.New(config))
-	r.OPTIONS("/*path", func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", os.Getenv("ALLOW_ORIGIN"))
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Status(http.StatusOK)
-	})
+	// Audit entries are chained and written in background, readiness fails while the queue is saturated
+	stopAudit := audit.Start()
+	handlers.AddReadinessCheck("audit queue", audit.CheckQueue)
 
-	//r.POST("/register", auth.Register)
-	r.POST("/login", auth.Login)
+	// CV downloads are saved in background too
+	stopDownloads := handlers.StartDownloadRecorder()
+	handlers.AddReadinessCheck("downloads queue", handlers.CheckDownloadQueue)
 
-	// Public routes (no authentication required)
-	r.GET("/cv/download", handlers.DownloadCV)
+	// Initialize the mail backend used for password resets, mails are sent in background
+	mailer.InitMailer(cfg.Mail)
+	stopMailer := mailer.Start()
 
-	// Tracking Route for users
-	r.POST("/info", handlers.TrackData)
+	// Initialize the identity provider of the OIDC login, when configured
+	oidc.InitOIDC(cfg.OIDC)
 
-	// Protected routes (authentication required)
+	// Initialize the relying party of the passkey logins
+	webauthn.InitWebAuthn(cfg.WebAuthn)
 
-	r.POST("/cv/upload", handlers.UploadCV)
+	// Load the token signing keys, rotated in background
+	auth.InitSigningKeys()
+	stopKeyRotation := auth.StartKeyRotation()
 
-	// Analytics Routes for admin area
-	analyticsGroup := r.Group("/analytics")
-	{
-		analyticsGroup.GET("/daily-users", handlers.GetDailyUniqueUsers)
-		analyticsGroup.GET("/page-time", handlers.GetPageTimeStats)
-		analyticsGroup.GET("/downloads", handlers.GetDownloadStats)
-		analyticsGroup.GET("/interactions", handlers.GetInteractionStats)
-		analyticsGroup.GET("/devices", handlers.GetDeviceStats)
-		analyticsGroup.GET("/browsers", handlers.GetBrowserStats)
+	// Initialize blob storage for uploaded files
+	storage.InitStorage(cfg.Storage)
+
+	// Register the routes, every route must have an authentication policy
+	r, router := setupRouter(cfg.CORS, cfg.TrustedProxies)
+	if err := router.CheckPolicies(); err != nil {
+		log.Fatal(err)
 	}
 
 	// Start HTTP server
 	server := &http.Server{
-		Addr:         fmt.Sprintf(":%s", os.Getenv("PORT")),
+		Addr:         fmt.Sprintf(":%s", cfg.Port),
 		Handler:      r,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
@@ -107,22 +235,75 @@ func main() {
 
 	// Start the server in a goroutine
 	go func() {
-		fmt.Println("Starting server on port", os.Getenv("PORT"))
+		fmt.Println("Starting server on port", cfg.Port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatal("ListenAndServe(): ", err)
 		}
 	}()
 
-	// Graceful shutdown handling
+	// Graceful shutdown handling, a second signal stops the process without waiting
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+	go func() {
+		<-sigChan
+		fmt.Println("Second signal received, exiting without waiting")
+		os.Exit(1)
+	}()
+
+	shutdown(server, cfg.Shutdown, workers{
+		keyRotation: stopKeyRotation,
+		downloads:   stopDownloads,
+		mail:        stopMailer,
+		audit:       stopAudit,
+	})
+}
+
+// workers are the stop functions of the background workers, each returns once the
+// items queued before are written
+type workers struct {
+	keyRotation func()
+	downloads   func()
+	mail        func()
+	audit       func()
+}
 
-	// Graceful shutdown: shut down the server and MongoDB connection
-	fmt.Println("Shutting down server...")
-	if err := server.Close(); err != nil {
-		log.Fatal("Server close:", err)
+// shutdown stops the backend in order:
+//  1. readiness fails, so no new requests are routed here
+//  2. the requests in flight are drained
+//  3. the key rotation stops, then the download recorder and the mail outbox save
+//     and send their queued items
+//  4. the audit writer stops, after every worker which may still record entries
+//  5. MongoDB, which they all write to, is disconnected
+func shutdown(server *http.Server, cfg config.Shutdown, stop workers) {
+	start := time.Now()
+	phase := func(name string, run func()) {
+		phaseStart := time.Now()
+		fmt.Printf("Shutdown: %s...\n", name)
+		run()
+		fmt.Printf("Shutdown: %s done in %v\n", name, time.Since(phaseStart).Round(time.Millisecond))
 	}
 
-	mongodb.CloseMongoDB()
+	phase("failing readiness", func() {
+		handlers.MarkShuttingDown()
+		time.Sleep(cfg.ReadinessDelay)
+	})
+
+	phase("draining requests", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			fmt.Println("Shutdown: requests still running after", cfg.Timeout, "closing their connections:", err)
+			server.Close()
+		}
+	})
+
+	phase("stopping key rotation", stop.keyRotation)
+	phase("saving queued downloads", stop.downloads)
+	phase("sending queued mails", stop.mail)
+	phase("writing queued audit entries", stop.audit)
+
+	phase("disconnecting MongoDB", mongodb.CloseMongoDB)
+
+	fmt.Printf("Shutdown complete in %v\n", time.Since(start).Round(time.Millisecond))
 }
@@ -0,0 +1,104 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var apiKeysCollection *mongo.Collection
+
+func initAPIKeysCollection(db *mongo.Database) {
+	apiKeysCollection = db.Collection("api_keys")
+
+	_, err := apiKeysCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "keyHash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Error creating API key indexes: %v", err)
+	}
+}
+
+// SaveAPIKey stores a new API key, only the hash of the key is persisted
+func SaveAPIKey(key models.APIKey) (string, error) {
+	data, err := apiKeysCollection.InsertOne(context.Background(), key)
+	if err != nil {
+		return "", fmt.Errorf("error inserting API key: %v", err)
+	}
+	id, ok := data.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("error converting inserted ID ObjectId")
+	}
+	return id.Hex(), nil
+}
+
+// ListAPIKeys returns every API key, newest first
+func ListAPIKeys() ([]models.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := apiKeysCollection.Find(context.Background(), bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing API keys: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	keys := []models.APIKey{}
+	if err := cursor.All(context.Background(), &keys); err != nil {
+		return nil, fmt.Errorf("error decoding API keys: %v", err)
+	}
+	return keys, nil
+}
+
+// FindAPIKey returns the API key with the given hash, nil if it does not exist
+func FindAPIKey(keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := apiKeysCollection.FindOne(context.Background(), bson.M{"keyHash": keyHash}).Decode(&key)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding API key: %v", err)
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey marks the API key as revoked, it is refused from the next request
+func RevokeAPIKey(keyID string) error {
+	objectID, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		return fmt.Errorf("invalid API key ID format: %v", err)
+	}
+
+	filter := bson.M{"_id": objectID}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}}
+	result, err := apiKeysCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return fmt.Errorf("error revoking API key: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// TouchAPIKey records the last use of the API key
+func TouchAPIKey(keyID string, at time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(keyID)
+	if err != nil {
+		return fmt.Errorf("invalid API key ID format: %v", err)
+	}
+
+	update := bson.M{"$set": bson.M{"lastUsedAt": at}}
+	if _, err := apiKeysCollection.UpdateOne(context.Background(), bson.M{"_id": objectID}, update); err != nil {
+		return fmt.Errorf("error updating API key: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrAuditSeqTaken is returned when another instance appended an entry with the same seq
+var ErrAuditSeqTaken = errors.New("audit seq already taken")
+
+var auditCollection *mongo.Collection
+
+func initAuditCollection(db *mongo.Database) {
+	auditCollection = db.Collection("audit")
+
+	_, err := auditCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("Error creating audit indexes: %v", err)
+	}
+}
+
+// LastAuditEntry returns the entry with the highest seq, nil if the log is empty
+func LastAuditEntry() (*models.AuditEntry, error) {
+	var last models.AuditEntry
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+	err := auditCollection.FindOne(context.Background(), bson.M{}, opts).Decode(&last)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding last audit entry: %v", err)
+	}
+	return &last, nil
+}
+
+// InsertAuditEntry inserts an entry already chained by the caller. The unique seq index
+// refuses a second entry with the same seq, ErrAuditSeqTaken is returned then.
+// The audit collection is append-only, there is no update or delete.
+func InsertAuditEntry(entry models.AuditEntry) error {
+	_, err := auditCollection.InsertOne(context.Background(), entry)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrAuditSeqTaken
+		}
+		return fmt.Errorf("error inserting audit entry: %v", err)
+	}
+	return nil
+}
+
+// FindAuditEntries returns a page of entries matching the filter, newest first, and the number of matches
+func FindAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, int64, error) {
+	query := bson.M{}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.Actor != "" {
+		query["actor"] = filter.Actor
+	}
+	if filter.Outcome != "" {
+		query["outcome"] = filter.Outcome
+	}
+	if filter.StartDate != nil || filter.EndDate != nil {
+		timestamp := bson.M{}
+		if filter.StartDate != nil {
+			timestamp["$gte"] = *filter.StartDate
+		}
+		if filter.EndDate != nil {
+			timestamp["$lt"] = *filter.EndDate
+		}
+		query["timestamp"] = timestamp
+	}
+
+	ctx := context.Background()
+	total, err := auditCollection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error counting audit entries: %v", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "seq", Value: -1}}).
+		SetSkip((filter.Page - 1) * filter.Limit).
+		SetLimit(filter.Limit)
+	cursor, err := auditCollection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error finding audit entries: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, fmt.Errorf("error decoding audit entries: %v", err)
+	}
+	return entries, total, nil
+}
+
+// AuditChainReport is the result of VerifyAuditChain
+type AuditChainReport struct {
+	Checked  int64 // entries checked
+	BrokenAt int64 // seq of the first entry breaking the chain, 0 if the chain is intact
+}
+
+// VerifyAuditChain walks the whole log in order and checks the hashes with key,
+// an entry which is not keyed breaks the chain
+func VerifyAuditChain(key []byte) (AuditChainReport, error) {
+	report := AuditChainReport{}
+	ctx := context.Background()
+	cursor, err := auditCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return report, fmt.Errorf("error reading audit entries: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	previous := models.AuditEntry{}
+	for cursor.Next(ctx) {
+		var entry models.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return report, fmt.Errorf("error decoding audit entry: %v", err)
+		}
+		report.Checked++
+
+		// A removed entry leaves a gap in seq, an edited one changes its hash
+		if entry.HashVersion != models.AuditHashKeyed || entry.Seq != previous.Seq+1 || entry.PrevHash != previous.Hash || entry.Hash != entry.ComputeHash(key) {
+			report.BrokenAt = entry.Seq
+			return report, nil
+		}
+		previous = entry
+	}
+	if err := cursor.Err(); err != nil {
+		return report, fmt.Errorf("error reading audit entries: %v", err)
+	}
+
+	return report, nil
+}
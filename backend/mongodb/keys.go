@@ -0,0 +1,53 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var signingKeysCollection *mongo.Collection
+
+func initKeysCollection(db *mongo.Database) {
+	signingKeysCollection = db.Collection("signing_keys")
+
+	// Keys past their grace period are removed by MongoDB
+	_, err := signingKeysCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating signing key indexes: %v", err)
+	}
+}
+
+// ListSigningKeys returns the keys still verifying tokens at the given time, newest first
+func ListSigningKeys(now time.Time) ([]models.SigningKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := signingKeysCollection.Find(context.Background(), bson.M{"expiresAt": bson.M{"$gt": now}}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing signing keys: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	keys := []models.SigningKey{}
+	if err := cursor.All(context.Background(), &keys); err != nil {
+		return nil, fmt.Errorf("error decoding signing keys: %v", err)
+	}
+	return keys, nil
+}
+
+// SaveSigningKey stores a new signing key, the private key must already be encrypted
+func SaveSigningKey(key models.SigningKey) error {
+	if _, err := signingKeysCollection.InsertOne(context.Background(), key); err != nil {
+		return fmt.Errorf("error inserting signing key: %v", err)
+	}
+	return nil
+}
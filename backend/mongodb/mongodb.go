@@ -1,54 +1,43 @@
 package mongodb
 
 import (
+	"backend/internal/config"
 	"backend/internal/models"
-	"backend/internal/utils"
+	"backend/internal/passwords"
 
 	"context"
 	"fmt"
 	"log"
-	"os"
+	"sort"
 	"time"
 
-	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Global variable to hold the MongoDB client
 var Client *mongo.Client
 var usersCollection *mongo.Collection
 var trkCollection *mongo.Collection
+var cvUploadsCollection *mongo.Collection
+var downloadsCollection *mongo.Collection
 
-// InitMongoDB initializes the MongoDB connection and assigns it to the global Client variable
-func InitMongoDB() {
-	// Load environment variables from .env file
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	// Get MongoDB connection details from environment variables
-	mongoURI := os.Getenv("MONGO_URI")
-	if mongoURI == "" {
-		log.Fatal("MONGO_URI is not set in environment variables")
-	}
-
-	mongoUser := os.Getenv("MONGO_USERNAME")
-	mongoPassword := os.Getenv("MONGO_PASSWORD")
+// DatabaseName is the database of the backend, set by InitMongoDB
+var DatabaseName string
 
+// InitMongoDB initializes the MongoDB connection and assigns it to the global Client variable,
+// then creates the root user if it does not exist yet
+func InitMongoDB(cfg config.Mongo, root config.Root) {
 	// Set up client options
-	clientOptions := options.Client().ApplyURI(mongoURI)
+	clientOptions := options.Client().ApplyURI(cfg.URI.Value())
 
 	// If authentication is required, set up the credentials
-	if mongoUser != "" && mongoPassword != "" {
+	if cfg.Username != "" && cfg.Password != "" {
 		clientOptions.SetAuth(options.Credential{
-			Username: mongoUser,
-			Password: mongoPassword,
+			Username: cfg.Username,
+			Password: cfg.Password.Value(),
 		})
 	}
 
@@ -62,61 +51,73 @@ func InitMongoDB() {
 	// Ping MongoDB to ensure the connection is established
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	err = Client.Ping(ctx, nil)
+	err := Client.Ping(ctx, nil)
 	if err != nil {
 		log.Fatal("Failed to ping MongoDB:", err)
 	}
 
-	dbName := os.Getenv("DB_NAME")
-	if dbName == "" {
-		log.Fatal("DB_NAME is not set in environment variables")
-	}
+	dbName := cfg.Database
+	DatabaseName = dbName
 
 	usersCollection = Client.Database(dbName).Collection("users")
 	trkCollection = Client.Database(dbName).Collection("trk")
+	cvUploadsCollection = Client.Database(dbName).Collection("cv_uploads")
+	downloadsCollection = Client.Database(dbName).Collection("downloads")
 
 	CreateAnalyticsIndexes()
+	initTokenCollections(Client.Database(dbName))
+	initSessionsCollection(Client.Database(dbName))
+	initUserCollections(Client.Database(dbName))
+	initThrottleCollection(Client.Database(dbName))
+	initKeysCollection(Client.Database(dbName))
+	initAPIKeysCollection(Client.Database(dbName))
+	initPasswordResetsCollection(Client.Database(dbName))
+	initAuditCollection(Client.Database(dbName))
+	initOIDCCollection(Client.Database(dbName))
+	initWebAuthnCollection(Client.Database(dbName))
 
 	fmt.Println("Connected to MongoDB and initialized collection with !")
 
-	rootUsername := os.Getenv("ROOT_USERNAME")
-	if rootUsername == "" {
-		log.Fatal("ROOT_USERNAME missing on env file")
-	}
-
-	storedUser, err := FindUserByUsername(rootUsername, false)
+	storedUser, err := FindUserByUsername(root.Username, false)
 	if err != nil || storedUser == nil {
 		fmt.Println("Root user doesnt exists, creating Root user")
 
-		CreateRootUser()
+		CreateRootUser(root)
 
 	} else {
 		fmt.Println("Root user already exists, skip creating user.")
+
+		// Root users created before roles existed become owners
+		if storedUser.Role == "" {
+			if err := SetUserRole(storedUser.Username, models.RoleOwner); err != nil {
+				log.Fatal("Could not set root user role : ", err.Error())
+			}
+		}
 	}
 
 }
 
-func CreateRootUser() (string, error) {
-	rootUsername := os.Getenv("ROOT_USERNAME")
-	rootPassword := os.Getenv("ROOT_PASSWORD")
-	rootEmail := os.Getenv("ROOT_EMAIL")
-
-	if rootUsername == "" || rootPassword == "" || rootEmail == "" {
+// CreateRootUser creates the owner account, ROOT_PASSWORD and ROOT_EMAIL are required on the first start
+func CreateRootUser(root config.Root) (string, error) {
+	if root.Username == "" || root.Password == "" || root.Email == "" {
 		log.Fatal("ROOT_USERNAME or ROOT_PASSWORD or ROOT_EMAIL missing on env file")
 	}
 
 	user := models.User{
-		Username: rootUsername,
-		Password: rootPassword,
-		Email:    rootEmail,
+		Username: root.Username,
+		Password: root.Password.Value(),
+		Email:    root.Email,
+		Role:     models.RoleOwner,
 	}
+	now := time.Now().UTC()
+	user.CreatedAt = &now
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := passwords.Hash(user.Password)
 	if err != nil {
 		log.Fatal("Could not hash password : ", err.Error())
 	}
 
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
 	userId, err := CreateUser(user)
 
 	// Create the user in the database
@@ -126,15 +127,8 @@ func CreateRootUser() (string, error) {
 
 	fmt.Println("Root user created with Id : ", userId)
 
-	// Generate JWT token for the newly created user
-	token, _, err := utils.GenerateJWT(user.Username)
-	if err != nil {
-		log.Fatal("Could not create token : ", err.Error())
-	}
-
-	fmt.Println("Root user created.")
-
-	return token, err
+	// No token is generated here, signing keys are loaded after the database
+	return userId, nil
 }
 
 // GetDatabase returns a MongoDB database by name
@@ -184,6 +178,17 @@ func convertToObjectIDs(stringIds []string) ([]primitive.ObjectID, error) {
 	return objectIDs, nil
 }
 
+// Ping checks the database answers, used by the readiness probe
+func Ping(ctx context.Context) error {
+	if Client == nil {
+		return fmt.Errorf("MongoDB client is not initialized")
+	}
+	if err := Client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("error pinging MongoDB: %v", err)
+	}
+	return nil
+}
+
 func CloseMongoDB() {
 	if Client != nil {
 		err := Client.Disconnect(context.Background())
@@ -256,6 +261,15 @@ func CreateUser(user models.User) (string, error) {
 	return id.Hex(), nil
 }
 
+// SetUserRole changes the role of the user
+func SetUserRole(username string, role string) error {
+	_, err := usersCollection.UpdateOne(context.Background(), bson.M{"username": username}, bson.M{"$set": bson.M{"role": role}})
+	if err != nil {
+		return fmt.Errorf("error updating user role: %v", err)
+	}
+	return nil
+}
+
 func FindUserById(userID string) (*models.User, error) {
 	var user models.User
 	userObjectId, err := primitive.ObjectIDFromHex(userID)
@@ -280,6 +294,43 @@ func SaveTrackData(trackData models.TrackData) {
 	}
 }
 
+// SaveCVUpload stores the metadata of an uploaded CV version
+func SaveCVUpload(upload models.CVUpload) (string, error) {
+	data, err := cvUploadsCollection.InsertOne(context.Background(), upload)
+	if err != nil {
+		return "", fmt.Errorf("error inserting cv upload: %v", err)
+	}
+	id, ok := data.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("error converting inserted ID ObjectId")
+	}
+
+	return id.Hex(), nil
+}
+
+// GetLatestCVUpload returns the metadata of the current CV version, nil if none was uploaded
+func GetLatestCVUpload(filename string) (*models.CVUpload, error) {
+	var upload models.CVUpload
+	opts := options.FindOne().SetSort(bson.D{{Key: "uploadedAt", Value: -1}})
+	err := cvUploadsCollection.FindOne(context.Background(), bson.M{"filename": filename}, opts).Decode(&upload)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding cv upload: %v", err)
+	}
+	return &upload, nil
+}
+
+// SaveDownloadEvent stores a CV download recorded by the server
+func SaveDownloadEvent(event models.DownloadEvent) {
+	_, err := downloadsCollection.InsertOne(context.Background(), event)
+
+	if err != nil {
+		fmt.Println("Error on insert DownloadEvent", err)
+	}
+}
+
 func GetDailyUniqueUsers(dateFilter models.DateRangeFilter) ([]models.DailyUserStats, error) {
 	fmt.Println("dateFilter", dateFilter)
 
@@ -394,17 +445,58 @@ func GetAverageTimePerPage(dateFilter models.DateRangeFilter) ([]models.PageTime
 	return results, nil
 }
 
+// GetDailyDownloads counts the downloads recorded server-side by handlers.DownloadCV.
+// Days before the first recorded download are counted from the download interactions
+// the frontend tracked before, so the history is kept.
 func GetDailyDownloads(dateFilter models.DateRangeFilter) ([]models.DownloadStats, error) {
+	startDate := dateFilter.StartDate.Format("2006-01-02")
+	endDate := dateFilter.EndDate.AddDate(0, 0, 1).Format("2006-01-02")
+
+	results, err := aggregateDownloads(downloadsCollection, bson.M{"date": bson.M{"$gte": startDate, "$lt": endDate}})
+	if err != nil {
+		return nil, err
+	}
+
+	// Server-side recording starts with the first download event
+	var first models.DownloadEvent
+	opts := options.FindOne().SetSort(bson.D{{Key: "date", Value: 1}})
+	err = downloadsCollection.FindOne(context.Background(), bson.M{}, opts).Decode(&first)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("error finding first download event: %v", err)
+	}
+	legacyEnd := endDate
+	if err == nil && len(first.Date) >= 10 && first.Date[:10] < legacyEnd {
+		legacyEnd = first.Date[:10]
+	}
+	if startDate >= legacyEnd {
+		return results, nil
+	}
+
+	legacy, err := aggregateDownloads(trkCollection, bson.M{
+		"date": bson.M{"$gte": startDate, "$lt": legacyEnd},
+		"type": "interaction",
+		"info": bson.M{"$regex": "download", "$options": "i"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Same ordering as the pipeline: date, then page
+	results = append(legacy, results...)
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Date != results[j].Date {
+			return results[i].Date < results[j].Date
+		}
+		return results[i].Page < results[j].Page
+	})
+	return results, nil
+}
+
+// aggregateDownloads counts the documents matching filter per day and page
+func aggregateDownloads(collection *mongo.Collection, filter bson.M) ([]models.DownloadStats, error) {
 	pipeline := mongo.Pipeline{
-		// Match date range, interaction type, and download info
-		{{Key: "$match", Value: bson.M{
-			"date": bson.M{
-				"$gte": dateFilter.StartDate.Format("2006-01-02"),
-				"$lt":  dateFilter.EndDate.AddDate(0, 0, 1).Format("2006-01-02"),
-			},
-			"type": "interaction",
-			"info": bson.M{"$regex": "download", "$options": "i"},
-		}}},
+		// Match date range
+		{{Key: "$match", Value: filter}},
 
 		// Extract date from datetime
 		{{Key: "$addFields", Value: bson.M{
@@ -430,7 +522,7 @@ func GetDailyDownloads(dateFilter models.DateRangeFilter) ([]models.DownloadStat
 		{{Key: "$sort", Value: bson.M{"date": 1, "page": 1}}},
 	}
 
-	cursor, err := trkCollection.Aggregate(context.Background(), pipeline)
+	cursor, err := collection.Aggregate(context.Background(), pipeline)
 	if err != nil {
 		return nil, fmt.Errorf("error aggregating download stats: %v", err)
 	}
@@ -672,4 +764,12 @@ func CreateAnalyticsIndexes() {
 	for i, name := range names {
 		fmt.Printf("%d. %s\n", i+1, name)
 	}
+
+	downloadsIndexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "date", Value: 1}, {Key: "page", Value: 1}}},
+		{Keys: bson.D{{Key: "ipHash", Value: 1}, {Key: "date", Value: 1}}},
+	}
+	if _, err := downloadsCollection.Indexes().CreateMany(ctx, downloadsIndexes); err != nil {
+		log.Printf("Error creating downloads indexes: %v", err)
+	}
 }
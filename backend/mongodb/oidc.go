@@ -0,0 +1,80 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var oidcStatesCollection *mongo.Collection
+
+func initOIDCCollection(db *mongo.Database) {
+	oidcStatesCollection = db.Collection("oidc_states")
+
+	_, err := oidcStatesCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating OIDC state indexes: %v", err)
+	}
+
+	// An identity provider account is linked to one user at most
+	_, err = usersCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "oidcSubject", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"oidcSubject": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		log.Printf("Error creating OIDC subject index: %v", err)
+	}
+}
+
+// SaveOIDCState stores a pending OIDC login
+func SaveOIDCState(state models.OIDCState) error {
+	if _, err := oidcStatesCollection.InsertOne(context.Background(), state); err != nil {
+		return fmt.Errorf("error inserting OIDC state: %v", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCState removes the pending login and returns it, or nil if it does not
+// exist or is expired. A state can be used once.
+func ConsumeOIDCState(stateHash string) (*models.OIDCState, error) {
+	filter := bson.M{"_id": stateHash, "expiresAt": bson.M{"$gt": time.Now().UTC()}}
+
+	var state models.OIDCState
+	err := oidcStatesCollection.FindOneAndDelete(context.Background(), filter).Decode(&state)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error deleting OIDC state: %v", err)
+	}
+	return &state, nil
+}
+
+// FindUserByOIDCSubject returns the user linked to the provider account, or nil
+func FindUserByOIDCSubject(subject string) (*models.User, error) {
+	var user models.User
+	err := usersCollection.FindOne(context.Background(), bson.M{"oidcSubject": subject}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding user: %v", err)
+	}
+	return &user, nil
+}
+
+// LinkOIDCSubject links the provider account to an existing user
+func LinkOIDCSubject(username string, subject string) error {
+	return updateUserByUsername(username, bson.M{"$set": bson.M{"oidcSubject": subject}})
+}
@@ -0,0 +1,80 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var passwordResetsCollection *mongo.Collection
+
+func initPasswordResetsCollection(db *mongo.Database) {
+	passwordResetsCollection = db.Collection("password_resets")
+
+	_, err := passwordResetsCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "username", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Error creating password reset indexes: %v", err)
+	}
+}
+
+// SavePasswordReset stores a reset request, only the hash of its token is persisted.
+// Previous requests of the same user are removed, only the last link works.
+func SavePasswordReset(reset models.PasswordReset) error {
+	if _, err := passwordResetsCollection.DeleteMany(context.Background(), bson.M{"username": reset.Username}); err != nil {
+		return fmt.Errorf("error deleting password resets: %v", err)
+	}
+	if _, err := passwordResetsCollection.InsertOne(context.Background(), reset); err != nil {
+		return fmt.Errorf("error inserting password reset: %v", err)
+	}
+	return nil
+}
+
+// ConsumePasswordReset marks the reset as used and returns it. It returns nil if the
+// token does not exist, was already used or is expired.
+func ConsumePasswordReset(tokenHash string) (*models.PasswordReset, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"usedAt": now}}
+
+	var reset models.PasswordReset
+	err := passwordResetsCollection.FindOneAndUpdate(context.Background(), filter, update).Decode(&reset)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error updating password reset: %v", err)
+	}
+	return &reset, nil
+}
+
+// RehashUserPassword replaces the password hash by an upgraded hash of the same password.
+// Nothing is changed if the password was changed meanwhile.
+func RehashUserPassword(username string, previousHash string, passwordHash string) error {
+	_, err := usersCollection.UpdateOne(context.Background(),
+		bson.M{"username": username, "password": previousHash},
+		bson.M{"$set": bson.M{"password": passwordHash}})
+	if err != nil {
+		return fmt.Errorf("error updating user: %v", err)
+	}
+	return nil
+}
+
+// UpdateUserPassword replaces the password hash and refuses every token issued before now
+func UpdateUserPassword(username string, passwordHash string, now time.Time) error {
+	return updateUserByUsername(username, bson.M{"$set": bson.M{"password": passwordHash, "sessionsRevokedAt": now}})
+}
@@ -0,0 +1,110 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var sessionsCollection *mongo.Collection
+
+func initSessionsCollection(db *mongo.Database) {
+	sessionsCollection = db.Collection("sessions")
+
+	_, err := sessionsCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "lastSeenAt", Value: -1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Error creating session indexes: %v", err)
+	}
+}
+
+// UpsertSession creates the session on login, or refreshes its client, last seen and
+// expiration when a refresh token of the family is used
+func UpsertSession(session models.Session) error {
+	filter := bson.M{"_id": session.ID}
+	update := bson.M{
+		"$set": bson.M{
+			"userAgent":  session.UserAgent,
+			"ip":         session.IP,
+			"lastSeenAt": session.LastSeenAt,
+			"expiresAt":  session.ExpiresAt,
+		},
+		"$setOnInsert": bson.M{
+			"username":  session.Username,
+			"createdAt": session.CreatedAt,
+		},
+	}
+
+	_, err := sessionsCollection.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error saving session: %v", err)
+	}
+	return nil
+}
+
+// FindSession returns the session with the given id, nil if it does not exist
+func FindSession(sessionID string) (*models.Session, error) {
+	var session models.Session
+	err := sessionsCollection.FindOne(context.Background(), bson.M{"_id": sessionID}).Decode(&session)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding session: %v", err)
+	}
+	return &session, nil
+}
+
+// ListUserSessions returns the active sessions of the user, most recently seen first
+func ListUserSessions(username string) ([]models.Session, error) {
+	filter := bson.M{
+		"username":  username,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now().UTC()},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "lastSeenAt", Value: -1}})
+
+	cursor, err := sessionsCollection.Find(context.Background(), filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	sessions := []models.Session{}
+	if err := cursor.All(context.Background(), &sessions); err != nil {
+		return nil, fmt.Errorf("error decoding sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+// TouchSession updates the last seen time and client of the session, unless it was
+// already updated less than interval ago
+func TouchSession(sessionID string, ip string, userAgent string, now time.Time, interval time.Duration) error {
+	filter := bson.M{"_id": sessionID, "lastSeenAt": bson.M{"$lt": now.Add(-interval)}}
+	update := bson.M{"$set": bson.M{"lastSeenAt": now, "ip": ip, "userAgent": userAgent}}
+
+	if _, err := sessionsCollection.UpdateOne(context.Background(), filter, update); err != nil {
+		return fmt.Errorf("error updating session: %v", err)
+	}
+	return nil
+}
+
+// revokeSessions terminates the sessions matching the filter, their access tokens are refused
+func revokeSessions(filter bson.M) error {
+	filter["revokedAt"] = bson.M{"$exists": false}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}}
+
+	if _, err := sessionsCollection.UpdateMany(context.Background(), filter, update); err != nil {
+		return fmt.Errorf("error revoking sessions: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var loginThrottleCollection *mongo.Collection
+
+func initThrottleCollection(db *mongo.Database) {
+	loginThrottleCollection = db.Collection("login_throttle")
+
+	_, err := loginThrottleCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating login throttle indexes: %v", err)
+	}
+}
+
+// AddLoginAttempt counts a starting attempt on the key and returns the updated document.
+// The window starts with the first attempt, MongoDB removes the document once expiresAt is reached.
+func AddLoginAttempt(key string, windowEnd time.Time) (*models.LoginThrottle, error) {
+	update := bson.M{
+		"$inc":         bson.M{"attempts": 1},
+		"$setOnInsert": bson.M{"expiresAt": windowEnd},
+	}
+	return updateLoginThrottle(bson.M{"_id": key}, update, true)
+}
+
+// ReleaseLoginAttempt uncounts an attempt that succeeded or was refused without being checked
+func ReleaseLoginAttempt(key string) error {
+	filter := bson.M{"_id": key, "attempts": bson.M{"$gt": 0}}
+	if _, err := loginThrottleCollection.UpdateOne(context.Background(), filter, bson.M{"$inc": bson.M{"attempts": -1}}); err != nil {
+		return fmt.Errorf("error updating login throttle: %v", err)
+	}
+	return nil
+}
+
+// RecordLoginFailure counts a failure on the key and returns the updated document,
+// nil if the window ended during the attempt
+func RecordLoginFailure(key string) (*models.LoginThrottle, error) {
+	return updateLoginThrottle(bson.M{"_id": key}, bson.M{"$inc": bson.M{"failures": 1}}, false)
+}
+
+// SetLoginLockout blocks the key until the given time. A full lockout also resets the
+// counters, the key starts a new window when it ends.
+func SetLoginLockout(key string, until time.Time, reset bool) error {
+	update := bson.M{"$max": bson.M{"lockedUntil": until, "expiresAt": until}}
+	if reset {
+		update["$set"] = bson.M{"attempts": 0, "failures": 0}
+	}
+	if _, err := loginThrottleCollection.UpdateOne(context.Background(), bson.M{"_id": key}, update); err != nil {
+		return fmt.Errorf("error updating login throttle: %v", err)
+	}
+	return nil
+}
+
+func updateLoginThrottle(filter bson.M, update bson.M, upsert bool) (*models.LoginThrottle, error) {
+	opts := options.FindOneAndUpdate().SetUpsert(upsert).SetReturnDocument(options.After)
+
+	var throttle models.LoginThrottle
+	err := loginThrottleCollection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&throttle)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error updating login throttle: %v", err)
+	}
+	return &throttle, nil
+}
+
+// ClearLoginFailures forgets the failures of the key, after a successful login
+func ClearLoginFailures(key string) error {
+	if _, err := loginThrottleCollection.DeleteOne(context.Background(), bson.M{"_id": key}); err != nil {
+		return fmt.Errorf("error clearing login throttle: %v", err)
+	}
+	return nil
+}
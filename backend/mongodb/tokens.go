@@ -0,0 +1,137 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var refreshTokensCollection *mongo.Collection
+var revokedTokensCollection *mongo.Collection
+
+func initTokenCollections(db *mongo.Database) {
+	refreshTokensCollection = db.Collection("refresh_tokens")
+	revokedTokensCollection = db.Collection("revoked_tokens")
+
+	ctx := context.Background()
+
+	// Expired documents are removed by MongoDB with TTL indexes
+	_, err := refreshTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "family", Value: 1}}},
+		{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Error creating refresh token indexes: %v", err)
+	}
+
+	_, err = revokedTokensCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating revoked token indexes: %v", err)
+	}
+}
+
+// SaveRefreshToken stores a new refresh token, only its hash is persisted
+func SaveRefreshToken(token models.RefreshToken) error {
+	_, err := refreshTokensCollection.InsertOne(context.Background(), token)
+	if err != nil {
+		return fmt.Errorf("error inserting refresh token: %v", err)
+	}
+	return nil
+}
+
+// FindRefreshToken returns the refresh token with the given hash, nil if it does not exist
+func FindRefreshToken(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := refreshTokensCollection.FindOne(context.Background(), bson.M{"tokenHash": tokenHash}).Decode(&token)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding refresh token: %v", err)
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed flags the token as used. It returns false if the token was
+// already used or revoked, which happens when a refresh token is replayed.
+func MarkRefreshTokenUsed(tokenHash string) (bool, error) {
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"usedAt":    bson.M{"$exists": false},
+		"revokedAt": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"usedAt": time.Now().UTC()}}
+
+	result, err := refreshTokensCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error updating refresh token: %v", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// RevokeRefreshFamily revokes every refresh token issued from the same login, and terminates its session
+func RevokeRefreshFamily(family string) error {
+	filter := bson.M{"family": family, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}}
+
+	if _, err := refreshTokensCollection.UpdateMany(context.Background(), filter, update); err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %v", err)
+	}
+	return revokeSessions(bson.M{"_id": family})
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of the user, and terminates its sessions
+func RevokeUserRefreshTokens(username string) error {
+	filter := bson.M{"username": username, "revokedAt": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}}
+
+	if _, err := refreshTokensCollection.UpdateMany(context.Background(), filter, update); err != nil {
+		return fmt.Errorf("error revoking refresh tokens: %v", err)
+	}
+	return revokeSessions(bson.M{"username": username})
+}
+
+// RevokeAccessToken adds the token id to the revocation list until the token expires
+func RevokeAccessToken(tokenID string, expiresAt time.Time) error {
+	filter := bson.M{"_id": tokenID}
+	update := bson.M{"$set": bson.M{"expiresAt": expiresAt}}
+
+	_, err := revokedTokensCollection.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("error revoking access token: %v", err)
+	}
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether the token id is in the revocation list
+func IsAccessTokenRevoked(tokenID string) (bool, error) {
+	count, err := revokedTokensCollection.CountDocuments(context.Background(), bson.M{"_id": tokenID}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("error checking revoked token: %v", err)
+	}
+	return count > 0, nil
+}
+
+// ConsumeTokenID records a single-use token id until the token expires.
+// It returns false if the id was already consumed.
+func ConsumeTokenID(tokenID string, expiresAt time.Time) (bool, error) {
+	_, err := revokedTokensCollection.InsertOne(context.Background(), bson.M{"_id": tokenID, "expiresAt": expiresAt})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error consuming token id: %v", err)
+	}
+	return true, nil
+}
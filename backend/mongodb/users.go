@@ -0,0 +1,240 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var invitationsCollection *mongo.Collection
+
+func initUserCollections(db *mongo.Database) {
+	invitationsCollection = db.Collection("invitations")
+
+	_, err := invitationsCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "tokenHash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("Error creating invitation indexes: %v", err)
+	}
+}
+
+// ListUsers returns every user without password hashes, sorted by username
+func ListUsers() ([]models.UserResponse, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "username", Value: 1}})
+	cursor, err := usersCollection.Find(context.Background(), bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	users := []models.UserResponse{}
+	if err := cursor.All(context.Background(), &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %v", err)
+	}
+
+	return users, nil
+}
+
+// SetUserDisabled disables or re-enables the user with the given id
+func SetUserDisabled(userID string, disabled bool) error {
+	return updateUserByID(userID, bson.M{"$set": bson.M{"disabled": disabled}})
+}
+
+// UpdateUserRole changes the role and the extra permissions of the user with the given id
+func UpdateUserRole(userID string, role string, permissions []string) error {
+	return updateUserByID(userID, bson.M{"$set": bson.M{"role": role, "permissions": permissions}})
+}
+
+// DeleteUser removes the user with the given id
+func DeleteUser(userID string) error {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID format: %v", err)
+	}
+
+	result, err := usersCollection.DeleteOne(context.Background(), bson.M{"_id": objectID})
+	if err != nil {
+		return fmt.Errorf("error deleting user: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// CountActiveOwners returns the number of enabled users with the owner role
+func CountActiveOwners() (int64, error) {
+	count, err := usersCollection.CountDocuments(context.Background(), bson.M{"role": models.RoleOwner, "disabled": bson.M{"$ne": true}})
+	if err != nil {
+		return 0, fmt.Errorf("error counting owners: %v", err)
+	}
+	return count, nil
+}
+
+func updateUserByID(userID string, update bson.M) error {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID format: %v", err)
+	}
+
+	result, err := usersCollection.UpdateOne(context.Background(), bson.M{"_id": objectID}, update)
+	if err != nil {
+		return fmt.Errorf("error updating user: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SaveInvitation stores a new invitation, only the hash of its token is persisted
+func SaveInvitation(invitation models.Invitation) (string, error) {
+	data, err := invitationsCollection.InsertOne(context.Background(), invitation)
+	if err != nil {
+		return "", fmt.Errorf("error inserting invitation: %v", err)
+	}
+	id, ok := data.InsertedID.(primitive.ObjectID)
+	if !ok {
+		return "", fmt.Errorf("error converting inserted ID ObjectId")
+	}
+	return id.Hex(), nil
+}
+
+// ListInvitations returns the invitations, newest first
+func ListInvitations() ([]models.Invitation, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := invitationsCollection.Find(context.Background(), bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error listing invitations: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	invitations := []models.Invitation{}
+	if err := cursor.All(context.Background(), &invitations); err != nil {
+		return nil, fmt.Errorf("error decoding invitations: %v", err)
+	}
+	return invitations, nil
+}
+
+// FindInvitation returns the invitation with the given token hash, nil if it does not exist
+func FindInvitation(tokenHash string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := invitationsCollection.FindOne(context.Background(), bson.M{"tokenHash": tokenHash}).Decode(&invitation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding invitation: %v", err)
+	}
+	return &invitation, nil
+}
+
+// MarkInvitationUsed consumes the invitation. It returns false if it was already used or expired.
+func MarkInvitationUsed(tokenHash string, username string) (bool, error) {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+	update := bson.M{"$set": bson.M{"usedAt": now, "usedBy": username}}
+
+	result, err := invitationsCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error updating invitation: %v", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// DeleteInvitation removes an invitation, so its token can no longer be used
+func DeleteInvitation(invitationID string) error {
+	objectID, err := primitive.ObjectIDFromHex(invitationID)
+	if err != nil {
+		return fmt.Errorf("invalid invitation ID format: %v", err)
+	}
+
+	result, err := invitationsCollection.DeleteOne(context.Background(), bson.M{"_id": objectID})
+	if err != nil {
+		return fmt.Errorf("error deleting invitation: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetPendingTOTPSecret stores the secret of an enrolment waiting for confirmation
+func SetPendingTOTPSecret(username string, secret string) error {
+	return updateUserByUsername(username, bson.M{"$set": bson.M{"totpPendingSecret": secret}})
+}
+
+// EnableTOTP activates the confirmed secret and replaces the recovery codes
+func EnableTOTP(username string, secret string, step int64, recoveryCodeHashes []string) error {
+	update := bson.M{
+		"$set": bson.M{
+			"totpEnabled":   true,
+			"totpSecret":    secret,
+			"totpLastStep":  step,
+			"recoveryCodes": recoveryCodeHashes,
+		},
+		"$unset": bson.M{"totpPendingSecret": ""},
+	}
+	return updateUserByUsername(username, update)
+}
+
+// DisableTOTP removes the second factor of the user
+func DisableTOTP(username string) error {
+	update := bson.M{
+		"$set":   bson.M{"totpEnabled": false},
+		"$unset": bson.M{"totpSecret": "", "totpPendingSecret": "", "totpLastStep": "", "recoveryCodes": ""},
+	}
+	return updateUserByUsername(username, update)
+}
+
+// MarkTOTPStepUsed records the time step of an accepted code. It returns false if that
+// step or a later one was already used, so a code cannot be replayed.
+func MarkTOTPStepUsed(username string, step int64) (bool, error) {
+	filter := bson.M{
+		"username": username,
+		"$or": bson.A{
+			bson.M{"totpLastStep": bson.M{"$exists": false}},
+			bson.M{"totpLastStep": bson.M{"$lt": step}},
+		},
+	}
+	result, err := usersCollection.UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{"totpLastStep": step}})
+	if err != nil {
+		return false, fmt.Errorf("error updating user: %v", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// ConsumeRecoveryCode removes the recovery code hash from the user. It returns false if the code was not there.
+func ConsumeRecoveryCode(username string, codeHash string) (bool, error) {
+	filter := bson.M{"username": username, "recoveryCodes": codeHash}
+	result, err := usersCollection.UpdateOne(context.Background(), filter, bson.M{"$pull": bson.M{"recoveryCodes": codeHash}})
+	if err != nil {
+		return false, fmt.Errorf("error updating user: %v", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func updateUserByUsername(username string, update bson.M) error {
+	result, err := usersCollection.UpdateOne(context.Background(), bson.M{"username": username}, update)
+	if err != nil {
+		return fmt.Errorf("error updating user: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
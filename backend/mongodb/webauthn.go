@@ -0,0 +1,120 @@
+package mongodb
+
+import (
+	"backend/internal/models"
+
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var webauthnChallengesCollection *mongo.Collection
+
+func initWebAuthnCollection(db *mongo.Database) {
+	webauthnChallengesCollection = db.Collection("webauthn_challenges")
+
+	_, err := webauthnChallengesCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating WebAuthn challenge indexes: %v", err)
+	}
+
+	// A credential belongs to one user, passkey logins look the user up by credential id
+	_, err = usersCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "webauthnCredentials.id", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"webauthnCredentials.id": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		log.Printf("Error creating WebAuthn credential index: %v", err)
+	}
+}
+
+// SaveWebAuthnChallenge stores a pending ceremony
+func SaveWebAuthnChallenge(challenge models.WebAuthnChallenge) error {
+	if _, err := webauthnChallengesCollection.InsertOne(context.Background(), challenge); err != nil {
+		return fmt.Errorf("error inserting WebAuthn challenge: %v", err)
+	}
+	return nil
+}
+
+// ConsumeWebAuthnChallenge removes the pending ceremony and returns it, or nil if it does
+// not exist, is expired or belongs to another ceremony. A challenge can be used once.
+func ConsumeWebAuthnChallenge(challengeHash string, ceremony string) (*models.WebAuthnChallenge, error) {
+	filter := bson.M{"_id": challengeHash, "ceremony": ceremony, "expiresAt": bson.M{"$gt": time.Now().UTC()}}
+
+	var challenge models.WebAuthnChallenge
+	err := webauthnChallengesCollection.FindOneAndDelete(context.Background(), filter).Decode(&challenge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error deleting WebAuthn challenge: %v", err)
+	}
+	return &challenge, nil
+}
+
+// AddWebAuthnCredential adds a passkey to the user
+func AddWebAuthnCredential(username string, credential models.WebAuthnCredential) error {
+	err := updateUserByUsername(username, bson.M{"$push": bson.M{"webauthnCredentials": credential}})
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("credential already registered")
+	}
+	return err
+}
+
+// FindUserByWebAuthnCredential returns the user owning the credential, or nil
+func FindUserByWebAuthnCredential(credentialID string) (*models.User, error) {
+	var user models.User
+	err := usersCollection.FindOne(context.Background(), bson.M{"webauthnCredentials.id": credentialID}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error finding user: %v", err)
+	}
+	return &user, nil
+}
+
+// UpdateWebAuthnSignCount stores the new signature counter of a credential. It returns false
+// if the counter changed since it was read, a concurrent login used the same credential.
+func UpdateWebAuthnSignCount(username string, credentialID string, previous, signCount uint32, now time.Time) (bool, error) {
+	filter := bson.M{
+		"username":            username,
+		"webauthnCredentials": bson.M{"$elemMatch": bson.M{"id": credentialID, "signCount": previous}},
+	}
+	update := bson.M{"$set": bson.M{
+		"webauthnCredentials.$.signCount":  signCount,
+		"webauthnCredentials.$.lastUsedAt": now,
+	}}
+
+	result, err := usersCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error updating user: %v", err)
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// RemoveWebAuthnCredential removes a passkey of the user, it returns false if it did not exist
+func RemoveWebAuthnCredential(username string, credentialID string) (bool, error) {
+	filter := bson.M{"username": username, "webauthnCredentials.id": credentialID}
+	update := bson.M{"$pull": bson.M{"webauthnCredentials": bson.M{"id": credentialID}}}
+
+	result, err := usersCollection.UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return false, fmt.Errorf("error updating user: %v", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// SetPasskeyOnly enables or disables password logins of the user
+func SetPasskeyOnly(username string, enabled bool) error {
+	return updateUserByUsername(username, bson.M{"$set": bson.M{"passkeyOnly": enabled}})
+}